@@ -0,0 +1,43 @@
+package hv
+
+import (
+	"io"
+	"os"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Write a file by handing write a temporary file in the same directory, which
+// is synced and renamed over filename only if write succeeds. A crash or error
+// part way through therefore never leaves filename truncated or half-written.
+func writeFileAtomically(filename string, write func(w io.Writer) error) (err error) {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	temp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	if err = write(temp); err != nil {
+		return
+	}
+	if err = temp.Chmod(0644); err != nil {
+		return
+	}
+	if err = temp.Sync(); err != nil {
+		return
+	}
+	if err = temp.Close(); err != nil {
+		return
+	}
+	return os.Rename(temp.Name(), filename)
+}
@@ -0,0 +1,95 @@
+package hv
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"bufio"
+	"sort"
+	"strings"
+	"path/filepath"
+)
+
+// The size and modification time of a file as of the last time it was hashed.
+type Stamp struct {
+	Size int64
+	ModTime int64
+}
+
+func StampOf(info os.FileInfo) Stamp {
+	return Stamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+}
+
+// The name of the sidecar file that caches the stamps of the files listed in
+// the checksum file named filename. It is hidden so that it is never itself
+// checksummed.
+func CacheFilename(filename string) string {
+	dir, base := filepath.Split(filename)
+	return filepath.Join(dir, fmt.Sprintf(".%s.cache", base))
+}
+
+// Read a stamp cache written by DumpCache. A cache that does not exist yet is
+// treated as empty.
+func LoadCache(filename string) (cache map[string]Stamp, err error) {
+	cache = make(map[string]Stamp)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return cache, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		escaped := strings.HasPrefix(line, EscapeMarker)
+		if escaped {
+			line = line[len(EscapeMarker):]
+		}
+
+		sep := strings.Index(line, Separator)
+		if sep == -1 {
+			continue
+		}
+
+		var stamp Stamp
+		if _, err := fmt.Sscanf(line[:sep], "%d %d", &stamp.Size, &stamp.ModTime); err != nil {
+			continue
+		}
+		name, ok := line[sep+len(Separator):], true
+		if escaped {
+			name, ok = unescapeFilename(name)
+		}
+		if ok {
+			cache[name] = stamp
+		}
+	}
+	return
+}
+
+func DumpCache(filename string, cache map[string]Stamp) error {
+	names := make([]string, 0, len(cache))
+	for name := range cache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return writeFileAtomically(filename, func(w io.Writer) error {
+		for _, name := range names {
+			stamp := cache[name]
+			marker, escaped := EscapeFilename(name)
+			if _, err := fmt.Fprintf(w, "%s%d %d%s%s\n", marker, stamp.Size, stamp.ModTime, Separator, escaped); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sort"
+	"container/list"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	// Declared in common:
+	// hashFunction HashValue
+	// dirs Strings
+	// manifestFiles Strings
+	// base string
+	// outputFormat OutputFormat
+	// strict bool
+)
+
+var cmdCollisions = &Command{
+	Run: runCollisions,
+	Usage: `collisions [-c=hash] [-D=dir ...] [-f=file ...] [--base=dir] [--format=format] [--strict]`,
+	Short: "Find hash collisions within a checksum file",
+	Long: `
+Find all instances of hash collisions for the given directory's checksum file, i.e.
+display all sets of files that have the same checksum but are not content-identical.
+Under a particular checksum, files that are actually identical will be clustered
+together, while files that are distinct are separated by a blank line.
+
+With -f, the given checksum file is used instead of the one in the directory,
+and with --base, filenames in it are relative to the given directory instead.
+Both -D and -f may be given more than once to look for collisions across several
+directories or checksum files, the same way as for dedup; with several
+directories, every file is then shown along with the directory it lives in.
+
+Expensive operations are avoided: if two files share the same checksum but are of
+different length, they are considered to be colliding and their contents are not
+actually compared.
+
+Improperly formatted lines in the checksum file are skipped with a warning, or
+are fatal with --strict.
+
+With --format=json or --format=ndjson, a record for every checksum is written to
+STDOUT instead, holding the clusters of identical files as nested arrays along
+with any errors.
+
+Checksums are reported in ascending order, and under each checksum, clusters are
+ordered by the path of their first file, which sorts first within its cluster.
+
+Warning: if your checksum file is not up-to-date or is incorrect, then the result
+of running this will be incorrect.`,
+}
+
+// Initialized in common:
+// var preferredHashes []string
+
+func init() {
+	const (
+		manifestUsage = "the checksum file to use instead of the one in the directory, or - for STDIN; may be repeated"
+		baseUsage = "the directory that filenames in the checksum file are relative to, if not the directory"
+		cwdUsage = "the directory in which to look for collisions using its checksum file; may be repeated"
+	)
+	strictUsage := "fail on the first improperly formatted line of the checksum file"
+	formatUsage := fmt.Sprintf("the output format: %s", strings.Join(outputFormat.Values(), ", "))
+	hashUsage := fmt.Sprintf("the hash to use; if unspecified, the following are tried in order: %s", strings.Join(preferredHashes, ", "))
+	f := &cmdCollisions.Flag
+	f.Var(&hashFunction, "c", hashUsage)
+	f.Var(&dirs, "D", cwdUsage)
+	f.Var(&manifestFiles, "f", manifestUsage)
+	f.StringVar(&base, "base", "", baseUsage)
+	f.Var(&outputFormat, "format", formatUsage)
+	f.BoolVar(&strict, "strict", false, strictUsage)
+}
+
+func runCollisions(cmd *Command, args []string) {
+	sums := openChecksumFiles()
+
+	buckets := sums.entries.BucketsByChecksum()
+	for _, checksum := range buckets.Checksums() {
+		bucket := buckets[checksum]
+		// A single file for a given checksum indicates no collisions
+		if bucket.Len() == 1 {
+			continue
+		}
+
+		record := &CollisionRecord{Checksum: checksum, Groups: make([][]string, 0)}
+
+		// Bucket files by size.
+		groups := hv.GroupBySize(sums.root, bucket)
+		if group, exists := groups[-1]; exists {
+			for e := group.Front(); e != nil; e = e.Next() {
+				err := e.Value.(error)
+				if outputFormat.IsText() {
+					croak(err)
+				}
+				record.Errors = append(record.Errors, err.Error())
+			}
+			delete(groups, -1)
+		}
+
+		var errs []string
+		switch {
+		case len(groups) == bucket.Len():
+			// All files are of different lengths. Then none of them are identical,
+			// and all files under this checksum are genuinely colliding. This is
+			// a plain collision.
+			collectPlain(record, groups)
+		default:
+			// Some or all of the files are of the same length. Some of them might
+			// be genuinely identical.
+			errs = collectMixed(record, groups)
+		}
+
+		// Groups come out of maps, so they are put in order of their first file,
+		// which keeps the report the same from one run to the next.
+		sort.Slice(record.Groups, func(i, j int) bool {
+			return record.Groups[i][0] < record.Groups[j][0]
+		})
+		sort.Strings(errs)
+		record.Errors = append(record.Errors, errs...)
+		sayCollisions(sums, record, errs)
+		emit(record)
+	}
+}
+
+func collectPlain(record *CollisionRecord, groups map[int64]*list.List) {
+	for _, group := range groups {
+		lazyfile := group.Front().Value.(*hv.LazyFile)
+		record.Groups = append(record.Groups, []string{lazyfile.Filename})
+	}
+}
+
+// Returns the errors of the files that could not be compared.
+func collectMixed(record *CollisionRecord, groups map[int64]*list.List) (errs []string) {
+	for _, group := range groups {
+		if group.Len() == 1 {
+			lazyfile := group.Front().Value.(*hv.LazyFile)
+			record.Groups = append(record.Groups, []string{lazyfile.Filename})
+			continue
+		}
+
+		buckets, berrs := hv.GroupByContent(group)
+		for _, bucket := range buckets {
+			files := make([]string, 0, len(bucket.Files))
+			for _, lazyfile := range bucket.Files {
+				files = append(files, lazyfile.Filename)
+			}
+			record.Groups = append(record.Groups, files)
+		}
+		for _, err := range berrs {
+			errs = append(errs, err.Error())
+		}
+	}
+	return
+}
+
+func sayCollisions(sums *checksumFiles, record *CollisionRecord, errs []string) {
+	say("%s\n", record.Checksum)
+	for _, files := range record.Groups {
+		for _, file := range files {
+			say("\t%s\n", sums.label(file))
+		}
+		say("\n")
+	}
+	for _, err := range errs {
+		say("\t%s\n", err)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"errors"
+	"strings"
+
+	"github.com/kourge/hv"
+)
+
+func warn(format string, a ...interface{}) (n int, err error) {
+	return fmt.Fprintf(os.Stderr, format, a...)
+}
+
+func croak(e error) {
+	warn("%s\n", e)
+}
+
+func die(e error) {
+	croak(e)
+	os.Exit(1)
+}
+
+// Exit with the given status once any pending output has been written.
+func exit(status int) {
+	flushRecords()
+	os.Exit(status)
+}
+
+var (
+	hashFunction hv.HashValue
+	cwd string
+	dryRun bool
+	silent bool
+	recursive bool
+	jobs int
+	outputFormat OutputFormat
+	strict bool
+	manifestFile string
+	base string
+	excludes Strings
+	includes Strings
+	dirs Strings
+	manifestFiles Strings
+)
+
+// Values given by repeating a flag.
+type Strings []string
+
+func (s *Strings) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *Strings) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+const (
+	excludeUsage = "leave out files and directories matching the gitignore-style pattern; may be repeated"
+	includeUsage = "find files and directories matching the gitignore-style pattern even if they would be left out; may be repeated"
+)
+
+// Escape filenames for a line of a report, the way coreutils does it, so that a
+// line break in one cannot split the line. If any were escaped, marker is to
+// start the line.
+func escapeFilenames(filenames ...string) (marker string, escaped []string) {
+	escaped = make([]string, len(filenames))
+	for i, filename := range filenames {
+		var m string
+		if m, escaped[i] = hv.EscapeFilename(filename); m != "" {
+			marker = m
+		}
+	}
+	return
+}
+
+// Warn about the malformed lines that were skipped in the checksum file named
+// filename, followed by a count of them.
+func warnMalformed(filename string, malformed []*hv.ParseError) {
+	if silent || len(malformed) == 0 {
+		return
+	}
+
+	for _, err := range malformed {
+		warn("%s: %s\n", filename, err)
+	}
+	if len(malformed) == 1 {
+		warn("WARNING: 1 line is improperly formatted\n")
+	} else {
+		warn("WARNING: %d lines are improperly formatted\n", len(malformed))
+	}
+}
+
+var preferredHashes = hv.PreferredHashes
+
+// The directory that filenames in the checksum file are relative to.
+func root() string {
+	if base != "" {
+		return base
+	}
+	return cwd
+}
+
+// Open the chosen checksum file, or - for STDIN, if there is one. Otherwise,
+// open the checksum file of the chosen directory for the chosen hash function,
+// or the first one found among preferredHashes if none was chosen. Malformed
+// lines are warned about, or are fatal in strict mode.
+func openManifest() *hv.Manifest {
+	m, err := loadManifest()
+	if err != nil {
+		die(err)
+	}
+	return m
+}
+
+// Like openManifest, but return the error instead of dying.
+func loadManifest() (m *hv.Manifest, err error) {
+	opts := hv.ReadOptions{Strict: strict}
+	switch manifestFile {
+	case "":
+		if m, err = hv.OpenManifest(cwd, hashFunction, opts); err == nil {
+			m.Root = root()
+		}
+	case "-":
+		m = &hv.Manifest{Hash: hashFunction, Filename: manifestFile, Root: root()}
+		err = m.Read(os.Stdin, opts)
+	default:
+		m, err = hv.OpenManifestFile(manifestFile, root(), hashFunction, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	warnMalformed(m.Filename, m.Malformed)
+	return
+}
+
+func walkOptions() hv.WalkOptions {
+	return hv.WalkOptions{Recursive: recursive, Exclude: excludes, Include: includes}
+}
+
+// The checksum files that dedup and collisions work on, with all of their
+// entries relative to a single root.
+type checksumFiles struct {
+	manifests []*hv.Manifest
+	entries hv.Entries
+	root string
+	// Where every entry came from, if there are several checksum files, in which
+	// case entries are named by their paths and root is empty.
+	origins map[string]hv.Origin
+	// Whether the checksum files belong to several directories.
+	roots bool
+	// The entries by filename, once any has been looked up.
+	named map[string]*hv.Entry
+}
+
+// Open the checksum file of every directory given by -D, or if -f is given, the
+// checksum files it gives instead. With at most one of each, they are taken the
+// way openManifest takes them. With more, the entries of all of them are
+// merged. Either way, filenames in a checksum file given by -f are relative to
+// the directory, or to --base, so -f cannot be given along with several
+// directories.
+func openChecksumFiles() *checksumFiles {
+	if len(dirs) <= 1 && len(manifestFiles) <= 1 {
+		cwd, manifestFile = ".", ""
+		if len(dirs) == 1 {
+			cwd = dirs[0]
+		}
+		if len(manifestFiles) == 1 {
+			manifestFile = manifestFiles[0]
+		}
+		m := openManifest()
+		return &checksumFiles{manifests: []*hv.Manifest{m}, entries: m.Entries, root: m.Root}
+	}
+	if len(dirs) > 1 && len(manifestFiles) > 0 {
+		die(errors.New("-f cannot be used with more than one directory, since filenames in it are relative to the directory"))
+	}
+	if len(dirs) > 1 && base != "" {
+		die(errors.New("--base cannot be used with more than one directory"))
+	}
+
+	sums := &checksumFiles{}
+	opts := hv.ReadOptions{Strict: strict}
+	if len(dirs) > 1 {
+		sums.roots = true
+		for _, dir := range dirs {
+			m, err := hv.OpenManifest(dir, hashFunction, opts)
+			if err == hv.ErrNoManifest {
+				err = fmt.Errorf("%s: %s", dir, err)
+			}
+			if err != nil {
+				die(err)
+			}
+			sums.manifests = append(sums.manifests, m)
+		}
+	} else {
+		cwd = "."
+		if len(dirs) == 1 {
+			cwd = dirs[0]
+		}
+		for _, filename := range manifestFiles {
+			if filename == "-" {
+				die(errors.New("a checksum file cannot be read from STDIN along with others"))
+			}
+			m, err := hv.OpenManifestFile(filename, root(), hashFunction, opts)
+			if err != nil {
+				die(err)
+			}
+			sums.manifests = append(sums.manifests, m)
+		}
+	}
+
+	first := sums.manifests[0]
+	for _, m := range sums.manifests {
+		warnMalformed(m.Filename, m.Malformed)
+		if m.Hash != first.Hash {
+			die(fmt.Errorf("%s and %s use different hash functions; choose one with -c", first.Filename, m.Filename))
+		}
+	}
+	sums.entries, sums.origins = hv.Merge(sums.manifests)
+	return sums
+}
+
+// The checksum file that filename, as named in sums.entries, came from, and its
+// entry there.
+func (sums *checksumFiles) origin(filename string) (*hv.Manifest, *hv.Entry) {
+	if origin, ok := sums.origins[filename]; ok {
+		return origin.Manifest, origin.Entry
+	}
+	if sums.named == nil {
+		sums.named = make(map[string]*hv.Entry, len(sums.entries))
+		for _, entry := range sums.entries {
+			sums.named[entry.Filename] = entry
+		}
+	}
+	return sums.manifests[0], sums.named[filename]
+}
+
+// How to show filename, as named in sums.entries, to the user: by its name in
+// the checksum file it came from, preceded by the directory it lives in if
+// there are several.
+func (sums *checksumFiles) label(filename string) string {
+	origin, ok := sums.origins[filename]
+	if !ok {
+		return filename
+	} else if sums.roots {
+		return fmt.Sprintf("%s: %s", origin.Manifest.Root, origin.Entry.Filename)
+	}
+	return origin.Entry.Filename
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"errors"
+	"os"
+	"path/filepath"
+	"container/list"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	// Declared in common:
+	// hashFunction HashValue
+	// dirs Strings
+	// manifestFiles Strings
+	// base string
+	// dryRun bool
+	// outputFormat OutputFormat
+	// strict bool
+	keepPolicy hv.KeepPolicy
+	linkMode hv.LinkMode
+	trash hv.Trash
+	journalFile string
+	journal *hv.Journal
+	noUpdateManifest bool
+	scriptFile string
+	plan *script
+	// The duplicates that are no longer where the checksum file says they are.
+	dropped []string
+)
+
+var cmdDedup = &Command{
+	Run: runDedup,
+	Usage: `dedup [-c=hash] [-D=dir ...] [-f=file ...] [--base=dir] [--keep=policy] [--link=type] [--trash=dir] [--journal=file] [--no-update-manifest] [--script=file] [--format=format] [--strict] [--dryrun]`,
+	Short: "deduplicate using a checksum file",
+	Long: `
+Deduplicate all files for the given directory against a checksum file. For every
+instance where multiple files share the same checksum, you are interactively
+prompted to pick one to keep, while the rest are deleted.
+
+With -f, the given checksum file is used instead of the one in the directory,
+and with --base, filenames in it are relative to the given directory instead.
+The checksum file can only be read from STDIN if a keep policy is given.
+
+Several directories can be deduplicated against each other by giving -D more
+than once, and several checksum files by giving -f more than once. Filenames in
+every checksum file given by -f are relative to the directory, or to the one
+given by --base, just as with a single one, so -f cannot be given along with
+several directories. All of them have to use the same hash function. Their
+entries are merged, so that duplicates are found across all of them, and every
+file is shown by its name in its checksum file, along with the directory it
+lives in if there are several, e.g. "photos: 2019/a.jpg". A file that is listed
+more than once, e.g. under directories given in different ways or under a link
+to it, is only taken once. Keep policies then look at the absolute path of every
+file, with symbolic links in its directory resolved, and duplicates are trashed
+under that path without its leading "/".
+
+If a keep policy is given, no prompts are shown and the file to keep is picked
+by the policy instead:
+
+  oldest              the file with the earliest modification time
+  newest              the file with the latest modification time
+  shortest-path       the file with the shortest path
+  longest-path        the file with the longest path
+  alphabetical-first  the file whose path sorts first
+  regex:PATTERN       the first file whose path matches the regular expression
+
+Ties are broken in favor of the file whose path sorts first. A set of
+duplicates for which the policy cannot pick a file, e.g. because no path matches
+the pattern, is left alone.
+
+If a link type is given, duplicates are replaced with a link to the file that is
+kept instead of being deleted: a hard link for "hard" and a relative symbolic
+link for "sym". Each link is created under a temporary name and then renamed
+over the duplicate, so the duplicate's path never disappears. A duplicate that
+cannot be linked, e.g. because a hard link would cross filesystems, is reported
+and left alone.
+
+If a trash directory is given, duplicates are moved into it instead of being
+deleted, under the same path relative to it as they had relative to the
+directory. A number is appended to the name of a duplicate whose place in the
+trash is already taken. When a link type is given as well, each duplicate is
+moved into the trash before the link takes its place. If the trash directory is
+on another filesystem, duplicates are copied into it instead, and each copy is
+synced and read back before the duplicate is removed. If it lives inside the
+directory, it is best hidden or excluded from the checksum file.
+
+Once all duplicates are dealt with, the checksum file is rewritten without the
+ones that were removed or trashed, replacing it atomically, so that it can still
+be verified. Duplicates that were replaced with a link stay in it. The checksum
+file is left alone with --no-update-manifest, when it was read from STDIN, or when
+it has improperly formatted lines, which would otherwise be lost.
+
+Every duplicate that is removed, linked or trashed is recorded in a journal: the
+file given by --journal, or else the file .hvjournal in the trash directory, or
+else in the first directory given by -D, or the current one. Trashed duplicates
+can be put back with the undo command, which also lists them in the checksum
+file again.
+
+With --script, nothing is touched; instead, a POSIX shell script of the commands
+that would have been run is written to the given file, so that it can be reviewed
+and run later. It changes to the current directory first, stops at the first
+command that fails, and holds a commented block for every set of duplicates,
+naming the file that is kept. Every path in it is quoted. The checksum file and
+the journal are left alone, so the checksum file is best updated with the update
+command once the script has been run.
+
+With --format=json or --format=ndjson, a record for every file in a set of
+duplicates is written to STDOUT instead of the usual commentary, with the file's
+checksum and what became of it as the status: kept, removed, linked, trashed,
+failed, skipped, stale or unreadable. Prompts are still written to STDERR.
+
+Improperly formatted lines in the checksum file are skipped with a warning, or
+are fatal with --strict.
+
+Sets of duplicates are handled in ascending order of their checksum, and the
+files in each set are listed in order of their path, so that two runs over the
+same checksum file produce the same output.
+
+Before anything is touched, every set of duplicates is compared byte by byte. If
+their sizes or contents differ, the checksum file is probably stale; the set is
+reported as such and left alone. A duplicate that is the same file as the one
+that is kept, e.g. because one is a link to the other, is left alone as well.
+Still, if your checksum file is not up-to-date, files that have become
+duplicates since it was generated will not be found.`,
+}
+
+// Initialized in common:
+// var preferredHashes []string
+
+func init() {
+	const (
+		manifestUsage = "the checksum file to use instead of the one in the directory, or - for STDIN; may be repeated"
+		baseUsage = "the directory that filenames in the checksum file are relative to, if not the directory"
+		cwdUsage = "the directory to dedup using its checksum file; may be repeated"
+		dryRunUsage = "only output what would have been done; do not perform any destructive operations"
+		trashUsage = "the directory to move duplicates into instead of deleting them"
+		journalUsage = "the file to record every action in, if not .hvjournal in the trash directory or the directory"
+		noUpdateUsage = "leave the checksum file alone instead of dropping the duplicates that are gone"
+		scriptUsage = "write a shell script of what would have been done to the given file instead of doing it"
+	)
+	linkUsage := fmt.Sprintf("replace duplicates with links instead of deleting them: %s", strings.Join(linkMode.Values(), ", "))
+	strictUsage := "fail on the first improperly formatted line of the checksum file"
+	formatUsage := fmt.Sprintf("the output format: %s", strings.Join(outputFormat.Values(), ", "))
+	keepUsage := fmt.Sprintf("keep files by policy instead of prompting: %s", strings.Join(keepPolicy.Values(), ", "))
+	hashUsage := fmt.Sprintf("the hash to use; if unspecified, the following are tried in order: %s", strings.Join(preferredHashes, ", "))
+	f := &cmdDedup.Flag
+	f.Var(&hashFunction, "c", hashUsage)
+	f.Var(&dirs, "D", cwdUsage)
+	f.Var(&manifestFiles, "f", manifestUsage)
+	f.StringVar(&base, "base", "", baseUsage)
+	f.BoolVar(&dryRun, "dryrun", false, dryRunUsage)
+	f.Var(&keepPolicy, "keep", keepUsage)
+	f.Var(&linkMode, "link", linkUsage)
+	f.StringVar(&trash.Dir, "trash", "", trashUsage)
+	f.StringVar(&journalFile, "journal", "", journalUsage)
+	f.BoolVar(&noUpdateManifest, "no-update-manifest", false, noUpdateUsage)
+	f.StringVar(&scriptFile, "script", "", scriptUsage)
+	f.Var(&outputFormat, "format", formatUsage)
+	f.BoolVar(&strict, "strict", false, strictUsage)
+}
+
+func runDedup(cmd *Command, args []string) {
+	for _, filename := range manifestFiles {
+		if filename == "-" && !keepPolicy.IsSet() {
+			die(errors.New("a keep policy is needed to read the checksum file from STDIN"))
+		}
+	}
+	sums := openChecksumFiles()
+
+	if scriptFile != "" {
+		plan = openScript(scriptFile)
+		defer plan.close()
+		dryRun = true
+	}
+	if dryRun {
+		say("# Dry run mode is on\n")
+	} else {
+		openJournal()
+		defer journal.Close()
+	}
+
+	buckets := sums.entries.BucketsByChecksum()
+	for _, checksum := range buckets.Checksums() {
+		bucket := buckets[checksum]
+		if bucket.Len() <= 1 {
+			continue
+		}
+
+		if !confirmDuplicates(sums, bucket, checksum) {
+			continue
+		}
+
+		if keepPolicy.IsSet() {
+			applyKeepPolicy(sums, bucket, checksum)
+		} else {
+			promptForRemoval(sums, bucket, checksum)
+		}
+	}
+
+	if !dryRun {
+		updateManifests(sums)
+	}
+}
+
+// Drop the duplicates that are gone from the checksum files, unless told not
+// to. Linked duplicates stay, since their paths still hold the same content.
+func updateManifests(sums *checksumFiles) {
+	if noUpdateManifest || manifestFile == "-" {
+		return
+	}
+
+	gone := make(map[*hv.Manifest][]string)
+	for _, file := range dropped {
+		m, entry := sums.origin(file)
+		gone[m] = append(gone[m], entry.Filename)
+	}
+
+	for _, m := range sums.manifests {
+		filenames := gone[m]
+		if len(filenames) == 0 {
+			continue
+		}
+		if len(m.Malformed) > 0 {
+			warn("# Not updating %s, which has improperly formatted lines\n", m.Filename)
+			continue
+		}
+
+		tagged := m.Tagged()
+		m.Drop(filenames)
+		if err := m.Save(hv.WriteOptions{Tagged: tagged}); err != nil {
+			die(err)
+		}
+		say("# Dropped %d entries from %s\n", len(filenames), m.Filename)
+	}
+}
+
+// Whether updateManifests will drop the duplicates that are gone from m.
+func updatesManifest(m *hv.Manifest) bool {
+	return !noUpdateManifest && manifestFile != "-" && len(m.Malformed) == 0
+}
+
+// Confirm that all files among duplicates are byte-by-byte identical, so that a
+// stale checksum file cannot cause distinct files to be deleted. Any set that
+// is not confirmed is reported along with the reason.
+func confirmDuplicates(sums *checksumFiles, duplicates *list.List, checksum string) bool {
+	buckets, errs := hv.GroupIdentical(sums.root, duplicates)
+
+	if len(errs) > 0 {
+		say("# Skipping files with checksum %s, which could not be read:\n", checksum)
+		for _, err := range errs {
+			say("#   %s\n", err)
+			emit(&Record{File: errorPath(err), Expected: checksum, Status: "unreadable", Error: err.Error()})
+		}
+		say("\n")
+		return false
+	}
+
+	if len(buckets) > 1 {
+		say("# Skipping files with checksum %s, which are not identical; the checksum file is probably stale:\n", checksum)
+		for _, bucket := range buckets {
+			for _, file := range bucket.Files {
+				say("#   %s (%d bytes)\n", sums.label(file.Filename), file.Size())
+				emit(&Record{File: file.Filename, Expected: checksum, Status: "stale"})
+			}
+			say("#\n")
+		}
+		say("\n")
+		return false
+	}
+
+	return true
+}
+
+func promptForRemoval(sums *checksumFiles, duplicates *list.List, checksum string) {
+PROMPT:
+	for e, i := duplicates.Front(), 1; e != nil; e, i = e.Next(), i+1 {
+		file := e.Value.(string)
+		warn("# [%d] %s\n", i, sums.label(file))
+	}
+	warn("# All of these have checksum %s. Keep which? ", checksum)
+
+	var choice int
+	if n, err := fmt.Scanf("%d", &choice); err == nil && n == 1 {
+		if choice < 1 || choice > duplicates.Len() {
+			warn("# %d is not a valid choice\n\n", choice)
+			goto PROMPT
+		}
+		removeDuplicatesAndKeep(sums, duplicates, checksum, choice)
+	} else {
+		warn("# Please enter a number\n\n")
+		goto PROMPT
+	}
+}
+
+func applyKeepPolicy(sums *checksumFiles, duplicates *list.List, checksum string) {
+	for e, i := duplicates.Front(), 1; e != nil; e, i = e.Next(), i+1 {
+		file := e.Value.(string)
+		say("# [%d] %s\n", i, sums.label(file))
+	}
+	say("# All of these have checksum %s.\n", checksum)
+
+	choice, err := keepPolicy.Choose(sums.root, duplicates)
+	if err != nil {
+		say("# Skipping: %s\n\n", err)
+		for e := duplicates.Front(); e != nil; e = e.Next() {
+			emit(&Record{File: e.Value.(string), Expected: checksum, Status: "skipped", Error: err.Error()})
+		}
+		return
+	}
+	removeDuplicatesAndKeep(sums, duplicates, checksum, choice)
+}
+
+// Open the journal, creating the trash directory along the way if it is to hold
+// the journal. Without either, it is kept in the first directory given by -D,
+// or the current one.
+func openJournal() {
+	if journalFile == "" && trash.Dir != "" {
+		if err := os.MkdirAll(trash.Dir, 0755); err != nil {
+			die(err)
+		}
+		journalFile = filepath.Join(trash.Dir, hv.JournalFilename)
+	} else if journalFile == "" {
+		dir := "."
+		if len(dirs) > 0 {
+			dir = dirs[0]
+		}
+		journalFile = filepath.Join(dir, hv.JournalFilename)
+	}
+
+	var err error
+	if journal, err = hv.OpenJournal(journalFile); err != nil {
+		die(err)
+	}
+}
+
+func removeDuplicatesAndKeep(sums *checksumFiles, duplicates *list.List, checksum string, choice int) {
+	e := duplicates.Front()
+	for i := 1; i < choice; i++ {
+		e = e.Next()
+	}
+
+	kept := duplicates.Remove(e).(string)
+	say("# Keeping %s\n", sums.label(kept))
+	emit(&Record{File: kept, Expected: checksum, Status: "kept"})
+	plan.group(checksum, sums.label(kept))
+
+	for e = duplicates.Front(); e != nil; e = e.Next() {
+		file := e.Value.(string)
+		record := &Record{File: file, Expected: checksum, Target: kept}
+		target, path := hv.FilePath(sums.root, kept), hv.FilePath(sums.root, file)
+
+		// Getting rid of a link to the file that is kept, or of the file that a
+		// kept link leads to, would either gain nothing or lose the only copy.
+		if same, err := hv.SameFile(target, path); err != nil {
+			croak(err)
+			record.Status, record.Error = "failed", err.Error()
+			emit(record)
+			continue
+		} else if same {
+			say("# Skipping %s, which is the same file as %s\n", sums.label(file), sums.label(kept))
+			record.Status, record.Error = "skipped", "same file as the one that is kept"
+			emit(record)
+			continue
+		}
+
+		action, err := dispose(target, path, trashName(file))
+		if err != nil {
+			croak(err)
+			record.Status, record.Error = "failed", err.Error()
+			emit(record)
+			continue
+		}
+
+		switch {
+		case linkMode.IsSet(): record.Status = "linked"
+		case action.Trash != "": record.Status = "trashed"
+		default: record.Status = "removed"
+		}
+		record.Trash = action.Trash
+		emit(record)
+		if !linkMode.IsSet() {
+			dropped = append(dropped, file)
+			if m, entry := sums.origin(file); action.Trash != "" && updatesManifest(m) {
+				action.Dropped(absolute(m.Filename), entry)
+			}
+		}
+
+		if journal != nil {
+			if err := journal.Record(action); err != nil {
+				die(err)
+			}
+		}
+	}
+	say("\n")
+}
+
+// Get rid of the duplicate at path, which is to be named file in the trash, in
+// favor of the file at target: by moving it into the trash, by replacing it
+// with a link, by both, or by removing it. Returns what was done, for the
+// journal.
+func dispose(target, path, file string) (action hv.Action, err error) {
+	action = hv.Action{Op: "remove", Path: absolute(path), Target: absolute(target), Link: linkMode.Name}
+	if linkMode.IsSet() {
+		action.Op = "link"
+	}
+
+	if trash.Dir != "" {
+		trashed := hv.FilePath(trash.Dir, file)
+		if !dryRun {
+			if linkMode.IsSet() {
+				trashed, err = trash.Link(path, file)
+			} else {
+				trashed, err = trash.Move(path, file)
+			}
+			if err != nil {
+				return
+			}
+		}
+		if linkMode.IsSet() {
+			say("ln %s %s\n", path, trashed)
+		} else {
+			say("mv %s %s\n", path, trashed)
+		}
+		plan.run("mkdir", "-p", "--", filepath.Dir(trashed))
+		plan.run("test", "!", "-e", trashed)
+		if linkMode.IsSet() {
+			plan.run("ln", "--", path, trashed)
+		} else {
+			plan.run("mv", "--", path, trashed)
+		}
+		action.Op, action.Trash = "trash", absolute(trashed)
+	}
+
+	if linkMode.IsSet() {
+		if !dryRun {
+			if err = linkMode.Replace(target, path); err != nil {
+				if action.Trash != "" {
+					os.Remove(action.Trash)
+				}
+				return
+			}
+		}
+		say("%s\n", linkMode.Command(target, path))
+		if linkMode.Name == "sym" {
+			plan.run("ln", "-sf", "--", linkMode.Target(target, path), path)
+		} else {
+			plan.run("ln", "-f", "--", target, path)
+		}
+	} else if trash.Dir == "" {
+		if !dryRun {
+			if err = os.Remove(path); err != nil {
+				return
+			}
+		}
+		say("rm %s\n", path)
+		plan.run("rm", "--", path)
+	}
+	return
+}
+
+// The name in the trash for file, as named in the merged entries of the
+// checksum files: the same, but without the leading "/" that it only has when
+// there are several checksum files.
+func trashName(file string) string {
+	return strings.TrimLeft(file, "/")
+}
+
+// The absolute form of path, or path itself if there is none.
+func absolute(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+	"container/list"
+
+	"github.com/kourge/hv"
+)
+
+// A duplicate that is a link to the file that is kept, or the file that a kept
+// link leads to, is never removed.
+func TestDedupKeepsLinkedFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		link func(target, file string) error
+		keep int
+	}{
+		{"keep a symbolic link", func(target, file string) error { return os.Symlink("../a.txt", file) }, 2},
+		{"keep what a symbolic link leads to", func(target, file string) error { return os.Symlink("../a.txt", file) }, 1},
+		{"keep a hard link", os.Link, 2},
+		{"keep what a hard link leads to", os.Link, 1},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "hv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")
+		if err := ioutil.WriteFile(a, []byte("only copy\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(filepath.Dir(b), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := test.link(a, b); err != nil {
+			t.Skip(err)
+		}
+
+		duplicates := list.New()
+		duplicates.PushBack("a.txt")
+		duplicates.PushBack("sub/b.txt")
+		removeDuplicatesAndKeep(&checksumFiles{root: dir}, duplicates, "0123456789abcdef", test.keep)
+
+		for _, path := range []string{a, b} {
+			if data, err := ioutil.ReadFile(path); err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			} else if string(data) != "only copy\n" {
+				t.Errorf("%s: %s holds %q", test.name, path, data)
+			}
+		}
+	}
+	dropped = nil
+}
+
+// Duplicates that were replaced with symbolic links are confirmed as identical
+// on the next run, and left alone as the same file instead of as stale.
+func TestDedupAgainAfterSymbolicLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, path := range []string{a, b} {
+		if err := ioutil.WriteFile(path, []byte("only copy\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { linkMode = hv.LinkMode{} }()
+
+	sums := &checksumFiles{root: dir}
+	for _, mode := range []string{"sym", "hard"} {
+		if err := linkMode.Set(mode); err != nil {
+			t.Fatal(err)
+		}
+		duplicates := list.New()
+		duplicates.PushBack("a.txt")
+		duplicates.PushBack("b.txt")
+		if !confirmDuplicates(sums, duplicates, "0123456789abcdef") {
+			t.Fatalf("--link=%s: duplicates are not confirmed as identical", mode)
+		}
+		removeDuplicatesAndKeep(sums, duplicates, "0123456789abcdef", 1)
+
+		if info, err := os.Lstat(b); err != nil {
+			t.Fatal(err)
+		} else if info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("--link=%s: b.txt is no longer a symbolic link", mode)
+		}
+		if data, err := ioutil.ReadFile(b); err != nil || string(data) != "only copy\n" {
+			t.Errorf("--link=%s: b.txt holds %q, %v", mode, data, err)
+		}
+	}
+}
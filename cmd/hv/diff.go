@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	// Declared in common:
+	// silent bool
+	// outputFormat OutputFormat
+)
+
+var cmdDiff = &Command{
+	Run: runDiff,
+	Usage: `diff [-s] [--format=format] old new`,
+	Short: "Compare two checksum files",
+	Long: `
+Compare two checksum files, e.g. an old and a new SHA256SUMS of the same
+directory, and report every file that differs between them:
+
+  ADDED      the file is only in the new checksum file
+  REMOVED    the file is only in the old checksum file
+  MODIFIED   the file is in both, with different checksums
+  RENAMED    the file is only in the old checksum file, and a file with the same
+             checksum is only in the new one
+
+Files are compared by name and checksum alone; the files themselves are never
+read. Improperly formatted lines in either checksum file are skipped, and
+written to STDERR followed by a count of them, unless silent mode is on.
+
+Every difference is written to STDERR, sorted by filename, followed by a summary
+of the number of files in each class, unless silent mode is on. With
+--format=json or --format=ndjson, a record for every difference is written to
+STDOUT instead, with the old and new checksum as expected and actual, and for a
+renamed file, the old filename as from.
+
+The exit status is 0 if the checksum files list the same files with the same
+checksums, 1 if they do not, and 2 if either of them cannot be read.`,
+}
+
+func init() {
+	const (
+		silentUsage = "silent; don't output to STDERR"
+	)
+	formatUsage := fmt.Sprintf("the output format: %s", strings.Join(outputFormat.Values(), ", "))
+	f := &cmdDiff.Flag
+	f.BoolVar(&silent, "s", false, silentUsage)
+	f.Var(&outputFormat, "format", formatUsage)
+}
+
+func runDiff(cmd *Command, args []string) {
+	if len(args) != 2 {
+		cmd.PrintUsage(nil)
+		exit(2)
+	}
+
+	before, after := loadChecksums(args[0]), loadChecksums(args[1])
+
+	d := hv.Diff(before, after)
+	for _, filename := range d.Added {
+		sayDifference(&Record{File: filename, Status: "added", Actual: after[filename]})
+	}
+	for _, filename := range d.Removed {
+		sayDifference(&Record{File: filename, Status: "removed", Expected: before[filename]})
+	}
+	for _, filename := range d.Modified {
+		sayDifference(&Record{File: filename, Status: "modified", Expected: before[filename], Actual: after[filename]})
+	}
+	for _, rename := range d.Renamed {
+		sayDifference(&Record{File: rename.To, From: rename.From, Status: "renamed", Expected: before[rename.From], Actual: after[rename.To]})
+	}
+
+	if !silent {
+		say("%d added, %d removed, %d modified, %d renamed\n",
+			len(d.Added), len(d.Removed), len(d.Modified), len(d.Renamed))
+	}
+
+	if d.Empty() {
+		exit(0)
+	}
+	exit(1)
+}
+
+// The checksum of every file listed in the checksum file named filename, by
+// filename. Improperly formatted lines are warned about, and a checksum file
+// that cannot be read exits with 2.
+func loadChecksums(filename string) map[string]string {
+	m, err := hv.OpenManifestFile(filename, "", hv.HashValue{}, hv.ReadOptions{})
+	if err != nil {
+		croak(err)
+		exit(2)
+	}
+	warnMalformed(m.Filename, m.Malformed)
+
+	checksums := make(map[string]string, len(m.Entries))
+	for _, entry := range m.Entries {
+		checksums[entry.Filename] = entry.Checksum
+	}
+	return checksums
+}
+
+func sayDifference(record *Record) {
+	emit(record)
+	if silent {
+		return
+	}
+	if record.From != "" {
+		marker, names := escapeFilenames(record.From, record.File)
+		say("%s%-9s  %s -> %s\n", marker, strings.ToUpper(record.Status), names[0], names[1])
+	} else {
+		marker, names := escapeFilenames(record.File)
+		say("%s%-9s  %s\n", marker, strings.ToUpper(record.Status), names[0])
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"strings"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	// Declared in common:
+	// hashFunction HashValue
+	// cwd string
+	// silent bool
+	// recursive bool
+	// jobs int
+	// outputFormat OutputFormat
+	// Declared in generate:
+	// tag bool
+	empty bool
+)
+
+var cmdDupes = &Command{
+	Run: runDupes,
+	Usage: `dupes [-s] [-r] [-j=n] [-c=hash] [-D=dir] [--exclude=pattern] [--include=pattern] [--empty] [--tag] [--format=format]`,
+	Short: "Find duplicate files without a checksum file",
+	Long: `
+Find all sets of identical files in the given directory by reading the files
+themselves, so that no checksum file is needed and none can be out of date. Only
+top-level files are looked at unless -r is given, and files are skipped the same
+way as for generate.
+
+As few bytes as possible are read: files are first grouped by size, then files
+of the same size by a checksum of their first and last 4 KB, then the remaining
+candidates by a checksum of their whole content, and finally every set is
+compared byte by byte. Empty files are only reported with --empty.
+
+The duplicates are written to STDOUT as a checksum file for the chosen hash
+function, SHA1 by default, sorted by checksum and then by path, so that it can
+be handed straight to dedup:
+
+  hv dupes -r -D dir > dupes.txt
+  hv dedup -D dir -f dupes.txt
+
+With --tag, lines are written in the BSD or tagged format instead. With
+--format=json or --format=ndjson, a record for every set of duplicates is written
+instead, with their checksum, their size and their paths.
+
+Files that cannot be read are reported and left out, and the exit status is 1. A
+summary of the duplicates found is written to STDERR unless silent mode is on.`,
+}
+
+func init() {
+	const (
+		silentUsage = "silent; don't output to STDERR"
+		recursiveUsage = "descend into subdirectories"
+		jobsUsage = "the number of files to hash concurrently"
+		cwdUsage = "the directory in which to look for duplicates"
+		emptyUsage = "report empty files as duplicates of each other"
+		tagUsage = "write lines in the BSD or tagged format"
+	)
+	formatUsage := fmt.Sprintf("the output format: %s", strings.Join(outputFormat.Values(), ", "))
+	hashUsage := fmt.Sprintf("the hash function to use, e.g. %s", strings.Join(hashFunction.Values(), ", "))
+	f := &cmdDupes.Flag
+	f.BoolVar(&silent, "s", false, silentUsage)
+	f.BoolVar(&recursive, "r", false, recursiveUsage)
+	f.IntVar(&jobs, "j", 1, jobsUsage)
+	f.Var(&hashFunction, "c", hashUsage)
+	f.StringVar(&cwd, "D", ".", cwdUsage)
+	f.Var(&excludes, "exclude", excludeUsage)
+	f.Var(&includes, "include", includeUsage)
+	f.BoolVar(&empty, "empty", false, emptyUsage)
+	f.BoolVar(&tag, "tag", false, tagUsage)
+	f.Var(&outputFormat, "format", formatUsage)
+}
+
+func runDupes(cmd *Command, args []string) {
+	if hashFunction.Hash == 0 {
+		hashFunction.Set("SHA1")
+	}
+
+	opts := hv.DupesOptions{WalkOptions: walkOptions(), Hash: hashFunction, Jobs: jobs, Empty: empty}
+	sets, errs := hv.FindDuplicates(cwd, opts)
+	for _, err := range errs {
+		croak(err)
+	}
+
+	writer := hv.NewWriter(os.Stdout)
+	writer.Tagged = tag
+	var files int
+	var wasted int64
+	for _, d := range sets {
+		files += len(d.Filenames)
+		wasted += d.Size * int64(len(d.Filenames) - 1)
+		if !outputFormat.IsText() {
+			emit(&DuplicatesRecord{Checksum: d.Checksum, Size: d.Size, Files: d.Filenames})
+			continue
+		}
+		for _, entry := range d.Entries(hashFunction) {
+			if _, err := writer.WriteEntry(entry); err != nil {
+				die(err)
+			}
+		}
+	}
+
+	if !silent {
+		warn("%d files in %d sets of duplicates, %s in excess\n", files, len(sets), formatBytes(wasted))
+	}
+	if len(errs) > 0 {
+		exit(1)
+	}
+}
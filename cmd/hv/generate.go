@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"strings"
+	"errors"
+	"path/filepath"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	force bool
+	tag bool
+	keepGoing bool
+	sortOrder hv.SortOrder
+	hashFunctions hv.HashValues
+	// Declared in common:
+	// cwd string
+	// manifestFile string
+	// base string
+	// recursive bool
+	// jobs int
+	// Declared in progress:
+	// stats bool
+	// noProgress bool
+)
+
+var cmdGenerate = &Command{
+	Run: runGenerate,
+	Usage: `generate [-f] [-r] [-j=n] [-c=hash,...] [-D=dir] [-o=file] [--base=dir] [--keep-going] [--exclude=pattern] [--include=pattern] [--tag] [--sort=order] [--stats] [--no-progress] [-]`,
+	Short: "Generate a checksum file",
+	Long: `
+Generate a checksum file for the given directory. The generated checksum file
+will be named %sSUMS, where %s is the chosen hash function name in all caps.
+If several hash functions are chosen, separated by commas, a checksum file is
+generated for each of them, while every file is read only once.
+All top-level files will be accounted for; this process is not recursive unless
+-r is given, in which case files in subdirectories are included as well and are
+recorded by their slash-separated paths relative to the given directory. Hidden
+files and directories, as well as existing checksum files, are always skipped.
+
+Files and directories are skipped as well if they match a pattern in the .hvignore
+file of the directory whose files are checksummed, or a pattern given by
+--exclude. The .hvignore file works like a .gitignore file: one pattern per line,
+"#" starts a comment, and "!" negates a pattern. A pattern with a slash in it is
+matched against the path relative to the directory, any other pattern against
+the name alone, and a pattern ending with a slash only matches directories. A
+pattern given by --include finds files and directories even if they would be
+skipped otherwise, e.g. --include='.*' finds hidden files. Both flags may be
+repeated. Files in a skipped directory are never found.
+
+With --tag, lines are written in the BSD or tagged format, i.e.
+"SHA1 (file) = checksum", instead of the GNU format, i.e. "checksum  file".
+
+Files are hashed by up to n concurrent workers when -j is given. The order of the
+generated checksum file does not depend on the number of workers: files are
+sorted by path, or with --sort=size or --sort=mtime, by size or modification
+time, with ties sorted by path.
+
+While files are hashed, the number of files and bytes done so far, the total
+number of bytes, the throughput and the estimated time left are shown on STDERR,
+unless STDERR is not a terminal or --no-progress is given. With --stats, the
+number of files and bytes hashed and the time taken are written to STDERR at the
+end.
+
+With -o, the checksum file is written to the given path instead, which may have
+any name and live anywhere. With --base, the files of the given directory are
+checksummed instead, while the checksum file is still written to the directory
+given by -D unless -o is given.
+
+The checksum file is only written once every file has been hashed, to a temporary
+file that is then renamed over it, so an existing checksum file is left intact if
+any file cannot be read or the run is cut short. With --keep-going, files that
+cannot be read are reported and left out of the checksum file instead, which is
+written regardless, and the exit status is 1.
+
+Specifying - as the last argument, or as the path given to -o, will print the
+checksum file to STDOUT instead of writing it to a file. If several hash functions
+are chosen, -o cannot be used otherwise, and printing to STDOUT requires --tag so
+that every line names its hash function.`,
+}
+
+func init() {
+	const (
+		forceUsage = "overwrite an existing checksum file"
+		recursiveUsage = "descend into subdirectories"
+		tagUsage = "write lines in the BSD or tagged format"
+		jobsUsage = "the number of files to hash concurrently"
+		cwdUsage = "the directory for which to generate the checksum file"
+		outputUsage = "the path to write the checksum file to instead of the one in the directory"
+		baseUsage = "the directory whose files to checksum, if not the directory"
+		keepGoingUsage = "leave out files that cannot be read instead of failing"
+	)
+	sortUsage := fmt.Sprintf("the order of the checksum file: %s", strings.Join(sortOrder.Values(), ", "))
+	hashUsage := fmt.Sprintf("the hash functions to use, separated by commas, e.g. %s", strings.Join(hashFunction.Values(), ", "))
+	f := &cmdGenerate.Flag
+	f.BoolVar(&force, "f", false, forceUsage)
+	f.BoolVar(&recursive, "r", false, recursiveUsage)
+	f.IntVar(&jobs, "j", 1, jobsUsage)
+	f.BoolVar(&tag, "tag", false, tagUsage)
+	f.Var(&sortOrder, "sort", sortUsage)
+	f.Var(&hashFunctions, "c", hashUsage)
+	f.StringVar(&cwd, "D", ".", cwdUsage)
+	f.StringVar(&manifestFile, "o", "", outputUsage)
+	f.StringVar(&base, "base", "", baseUsage)
+	f.BoolVar(&keepGoing, "keep-going", false, keepGoingUsage)
+	f.Var(&excludes, "exclude", excludeUsage)
+	f.Var(&includes, "include", includeUsage)
+	f.BoolVar(&stats, "stats", false, statsUsage)
+	f.BoolVar(&noProgress, "no-progress", false, progressUsage)
+}
+
+func runGenerate(cmd *Command, args []string) {
+	hashes := []hv.HashValue(hashFunctions)
+	if len(hashes) == 0 {
+		hash := hv.HashValue{}
+		hash.Set("SHA1")
+		hashes = append(hashes, hash)
+	}
+
+	toStdout := manifestFile == "-" || (len(args) > 0 && args[0] == "-")
+	if len(hashes) > 1 {
+		if manifestFile != "" && !toStdout {
+			die(errors.New("-o cannot be used with more than one hash function"))
+		} else if toStdout && !tag {
+			die(errors.New("--tag is needed to print checksums of more than one hash function"))
+		}
+	}
+
+	checksumFiles := make([]string, len(hashes))
+	for i, hash := range hashes {
+		switch {
+		case toStdout:
+			checksumFiles[i] = "-"
+		case manifestFile != "":
+			checksumFiles[i] = manifestFile
+		default:
+			checksumFiles[i] = filepath.Join(cwd, hash.Filename())
+		}
+	}
+
+	for _, checksumFile := range checksumFiles {
+		if checksumFile == "-" {
+			continue
+		}
+		if _, err := os.Stat(checksumFile); err == nil && !force {
+			die(errors.New(fmt.Sprintf("%s already exists", checksumFile)))
+		}
+	}
+
+	progress, stop := startProgress()
+	opts := hv.GenerateOptions{WalkOptions: walkOptions(), Jobs: jobs, Progress: progress, KeepGoing: keepGoing, Sort: sortOrder}
+	opts.Ignore = checksumFiles
+	manifests, err := hv.GenerateAll(root(), hashes, opts)
+	stop()
+	failures, _ := err.(hv.Failures)
+	if err != nil && failures == nil {
+		die(err)
+	}
+	for _, failure := range failures {
+		croak(failure)
+	}
+
+	writeOpts := hv.WriteOptions{Tagged: tag}
+	for i, m := range manifests {
+		if checksumFiles[i] == "-" {
+			err = m.Write(os.Stdout, writeOpts)
+		} else {
+			m.Filename = checksumFiles[i]
+			err = m.Save(writeOpts)
+		}
+		if err != nil {
+			die(err)
+		}
+	}
+	sayStats(progress, fmt.Sprintf("%d files checksummed, %d unreadable", len(manifests[0].Entries), len(failures)))
+
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
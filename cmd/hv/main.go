@@ -7,9 +7,13 @@ import (
 
 var commands = []*Command {
 	cmdGenerate,
+	cmdUpdate,
 	cmdVerify,
 	cmdDedup,
 	cmdCollisions,
+	cmdDupes,
+	cmdDiff,
+	cmdUndo,
 	cmdHelp,
 }
 
@@ -40,6 +44,7 @@ func main() {
 				os.Exit(2)
 			}
 			cmd.Run(cmd, cmd.Flag.Args())
+			flushRecords()
 			return
 		}
 	}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"encoding/json"
+)
+
+// The format in which verify, dedup, collisions, diff, undo and dupes report
+// their findings. The text format writes prose to STDERR, while the JSON
+// formats write records to STDOUT: "json" as a single array once the command is
+// done, and "ndjson" as one record per line as soon as each is known.
+type OutputFormat struct {
+	Name string
+}
+
+func (f *OutputFormat) String() string {
+	if f.Name == "" {
+		return "text"
+	}
+	return f.Name
+}
+
+func (f *OutputFormat) Set(s string) (err error) {
+	switch s {
+	case "text", "json", "ndjson":
+		f.Name = s
+	default:
+		err = fmt.Errorf("%s is not a known output format", s)
+	}
+	return
+}
+
+func (f *OutputFormat) Values() []string {
+	return []string{"text", "json", "ndjson"}
+}
+
+func (f *OutputFormat) IsText() bool {
+	return f.Name == "" || f.Name == "text"
+}
+
+// A finding about a single file.
+type Record struct {
+	File string `json:"file"`
+	Expected string `json:"expected,omitempty"`
+	Actual string `json:"actual,omitempty"`
+	Status string `json:"status"`
+	// The file that was kept in place of this one, if any.
+	Target string `json:"target,omitempty"`
+	// The name that this file had before it was renamed, if it was.
+	From string `json:"from,omitempty"`
+	// Where this file was moved to in the trash, if it was.
+	Trash string `json:"trash,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// A set of files that share a checksum, subdivided into groups of files that
+// are identical to each other.
+type CollisionRecord struct {
+	Checksum string `json:"checksum"`
+	Groups [][]string `json:"groups"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// A set of files that are identical to each other.
+type DuplicatesRecord struct {
+	Checksum string `json:"checksum"`
+	Size int64 `json:"size"`
+	Files []string `json:"files"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// The file that err is about, if it is known.
+func errorPath(err error) string {
+	switch e := err.(type) {
+	case *os.PathError: return e.Path
+	case *os.LinkError: return e.New
+	default: return ""
+	}
+}
+
+var pendingRecords []interface{}
+
+// Add a record to the output of the current command. This does nothing in the
+// text format, where findings are written out with say instead.
+func emit(record interface{}) {
+	switch outputFormat.Name {
+	case "ndjson":
+		if err := json.NewEncoder(os.Stdout).Encode(record); err != nil {
+			die(err)
+		}
+	case "json":
+		pendingRecords = append(pendingRecords, record)
+	}
+}
+
+// Write out the records held back by the json format.
+func flushRecords() {
+	if outputFormat.Name != "json" {
+		return
+	}
+	if pendingRecords == nil {
+		pendingRecords = make([]interface{}, 0)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(pendingRecords); err != nil {
+		die(err)
+	}
+	pendingRecords = nil
+}
+
+// Like warn, but only in the text format.
+func say(format string, a ...interface{}) {
+	if outputFormat.IsText() {
+		warn(format, a...)
+	}
+}
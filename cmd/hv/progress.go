@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	stats bool
+	noProgress bool
+)
+
+const (
+	progressUsage = "don't show a progress display, even if STDERR is a terminal"
+	statsUsage = "write a summary of the number of files and bytes hashed and the time taken to STDERR at the end"
+)
+
+// How often the progress display is redrawn.
+const progressInterval = 250 * time.Millisecond
+
+// Whether STDERR is a terminal, and so can take a progress display that redraws
+// itself in place.
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode() & os.ModeCharDevice != 0
+}
+
+// Start counting the files and bytes hashed, if anything is going to report on
+// them, and draw a progress display on STDERR until the returned function is
+// called. The returned progress is nil if nothing is counted.
+func startProgress() (progress *hv.Progress, stop func()) {
+	display := !noProgress && !silent && stderrIsTerminal()
+	if !display && !stats {
+		return nil, func() {}
+	}
+
+	progress = &hv.Progress{Started: time.Now()}
+	if !display {
+		return progress, func() {}
+	}
+
+	done, finished := make(chan bool), make(chan bool)
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				warn("\r%s\033[K", formatProgress(progress))
+			case <-done:
+				warn("\r\033[K")
+				close(finished)
+				return
+			}
+		}
+	}()
+	return progress, func() {
+		close(done)
+		<-finished
+	}
+}
+
+// A line such as "12/340 files, 1.2 GB/45.0 GB, 123.4 MB/s, ETA 5m12s".
+func formatProgress(p *hv.Progress) string {
+	line := fmt.Sprintf("%d/%d files, %s/%s, %s",
+		p.Files(), p.TotalFiles(), formatBytes(p.Bytes()), formatBytes(p.TotalBytes()), formatRate(p.Rate()))
+	if remaining, ok := p.Remaining(); ok {
+		line += fmt.Sprintf(", ETA %s", remaining.Round(time.Second))
+	}
+	return line
+}
+
+// Write the summary asked for by --stats, if it was, followed by counts, which
+// describes what became of the files.
+func sayStats(p *hv.Progress, counts string) {
+	if !stats || p == nil {
+		return
+	}
+	elapsed := p.Elapsed()
+	warn("%s; hashed %d files, %s in %s, %s\n",
+		counts, p.Files(), formatBytes(p.Bytes()), elapsed.Round(time.Millisecond), formatRate(p.Rate()))
+}
+
+// A number of bytes in decimal units, e.g. "1.2 GB".
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefixes := float64(n) / unit, "kMGTPE"
+	i := 0
+	for ; value >= unit && i < len(prefixes) - 1; i++ {
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f %cB", value, prefixes[i])
+}
+
+func formatRate(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.1f MB/s", bytesPerSecond / 1e6)
+}
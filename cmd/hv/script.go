@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"bufio"
+	"strings"
+)
+
+// A POSIX shell script of the commands that dedup would have run, so that they
+// can be reviewed before they are run. Its methods do nothing on a nil script.
+type script struct {
+	file *os.File
+	w *bufio.Writer
+}
+
+// Create the script at filename and write its preamble, which changes to the
+// current directory, since every path in the script is relative to it.
+func openScript(filename string) *script {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		die(err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		die(err)
+	}
+
+	s := &script{file: file, w: bufio.NewWriter(file)}
+	fmt.Fprintf(s.w, "#!/bin/sh\n")
+	fmt.Fprintf(s.w, "# Written by hv dedup. Review every command before running this script.\n")
+	fmt.Fprintf(s.w, "set -e\n")
+	s.run("cd", "--", dir)
+	return s
+}
+
+// Start the commented block for the set of duplicates with checksum, among
+// which kept is the file that stays.
+func (s *script) group(checksum, kept string) {
+	if s == nil {
+		return
+	}
+	fmt.Fprintf(s.w, "\n# %s\n", checksum)
+	fmt.Fprintf(s.w, "# Keeping %s\n", commentSafe(kept))
+}
+
+// Add a command made of args, every one of which is quoted.
+func (s *script) run(args ...string) {
+	if s == nil {
+		return
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	fmt.Fprintf(s.w, "%s\n", strings.Join(quoted, " "))
+}
+
+func (s *script) close() {
+	if err := s.w.Flush(); err != nil {
+		die(err)
+	}
+	if err := s.file.Close(); err != nil {
+		die(err)
+	}
+}
+
+// Quote s for a POSIX shell, unless it only consists of characters that are
+// never special.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./=+,:@%") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Make s fit on a single comment line.
+func commentSafe(s string) string {
+	return strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(s)
+}
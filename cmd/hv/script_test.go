@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg string
+		quoted string
+	}{
+		{"plain/path-1.txt", "plain/path-1.txt"},
+		{"", "''"},
+		{"with space", "'with space'"},
+		{"it's", `'it'\''s'`},
+		{"''", `''\'''\'''`},
+		{"$(touch pwned)", "'$(touch pwned)'"},
+		{"`id`", "'`id`'"},
+		{"a;b&c|d", "'a;b&c|d'"},
+		{"*.txt", "'*.txt'"},
+		{"~user", "'~user'"},
+		{"line\nbreak", "'line\nbreak'"},
+		{`back\slash`, `'back\slash'`},
+		{"--", "--"},
+	}
+
+	sh, err := exec.LookPath("sh")
+	for _, test := range tests {
+		quoted := shellQuote(test.arg)
+		if quoted != test.quoted {
+			t.Errorf("shellQuote(%q) = %q, want %q", test.arg, quoted, test.quoted)
+		}
+
+		// The shell reads the quoted form back as the argument itself.
+		if err != nil {
+			continue
+		}
+		out, err := exec.Command(sh, "-c", "printf %s "+quoted).Output()
+		if err != nil {
+			t.Errorf("sh fails on %s: %s", quoted, err)
+		} else if string(out) != test.arg {
+			t.Errorf("sh reads %s as %q, want %q", quoted, out, test.arg)
+		}
+	}
+}
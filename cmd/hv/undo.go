@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"strings"
+	"path/filepath"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	// Declared in common:
+	// dryRun bool
+	// outputFormat OutputFormat
+)
+
+var cmdUndo = &Command{
+	Run: runUndo,
+	Usage: `undo [--format=format] [--dryrun] journal`,
+	Short: "Restore files that dedup moved into the trash",
+	Long: `
+Replay a journal kept by dedup in reverse, putting every trashed duplicate back
+where it was. The journal may be given as the file itself or as the directory
+that holds it, i.e. the trash directory, or the deduplicated directory if there
+was none.
+
+A duplicate is only put back if its place is empty, or still holds the link that
+dedup put there when a link type was given; otherwise it is reported and left in
+the trash. Duplicates that were deleted or replaced with a link without a trash
+directory are reported as skipped, since there is nothing to put back.
+
+Every duplicate that is put back is listed again in the checksum file that dedup
+dropped it from, unless it is already listed there, so that the checksum file can
+still be verified.
+
+Afterwards, the journal only holds the duplicates that could not be put back, so
+that undo can be run again once the cause is dealt with.
+
+With --format=json or --format=ndjson, a record for every action in the journal
+is written to STDOUT instead of the usual commentary, with the duplicate's path,
+where it was in the trash, and what became of it as the status: restored, failed
+or skipped.`,
+}
+
+func init() {
+	const (
+		dryRunUsage = "only output what would have been done; do not perform any destructive operations"
+	)
+	formatUsage := fmt.Sprintf("the output format: %s", strings.Join(outputFormat.Values(), ", "))
+	f := &cmdUndo.Flag
+	f.BoolVar(&dryRun, "dryrun", false, dryRunUsage)
+	f.Var(&outputFormat, "format", formatUsage)
+}
+
+func runUndo(cmd *Command, args []string) {
+	if len(args) != 1 {
+		cmd.PrintUsage(nil)
+		exit(2)
+	}
+
+	filename := args[0]
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		filename = filepath.Join(filename, hv.JournalFilename)
+	}
+	actions, err := hv.ReadJournal(filename)
+	if err != nil {
+		die(err)
+	}
+
+	if dryRun {
+		say("# Dry run mode is on\n")
+	}
+
+	var left, restored []hv.Action
+	for i := len(actions) - 1; i >= 0; i-- {
+		action := actions[i]
+		record := &Record{File: action.Path, Trash: action.Trash}
+		if !action.Undoable() {
+			say("# Skipping %s, which was not trashed\n", action.Path)
+			record.Status = "skipped"
+			emit(record)
+			continue
+		}
+
+		if !dryRun {
+			if err := action.Undo(); err != nil {
+				croak(err)
+				record.Status, record.Error = "failed", err.Error()
+				emit(record)
+				left = append([]hv.Action{action}, left...)
+				continue
+			}
+		}
+		say("mv %s %s\n", action.Trash, action.Path)
+		record.Status = "restored"
+		emit(record)
+		restored = append(restored, action)
+	}
+
+	if dryRun {
+		return
+	}
+	listed := relist(restored)
+	if err := hv.WriteJournal(filename, left); err != nil {
+		die(err)
+	}
+	if len(left) > 0 || !listed {
+		exit(1)
+	}
+}
+
+// List the entries of restored duplicates in the checksum files that dedup
+// dropped them from again. Returns whether all of them are listed.
+func relist(restored []hv.Action) (ok bool) {
+	ok = true
+	var filenames []string
+	dropped := make(map[string][]hv.Action)
+	for _, action := range restored {
+		if action.Manifest == "" {
+			continue
+		}
+		if _, exists := dropped[action.Manifest]; !exists {
+			filenames = append(filenames, action.Manifest)
+		}
+		dropped[action.Manifest] = append(dropped[action.Manifest], action)
+	}
+
+	for _, filename := range filenames {
+		m, err := hv.OpenManifestFile(filename, filepath.Dir(filename), hv.HashValue{}, hv.ReadOptions{})
+		if err != nil {
+			croak(err)
+			ok = false
+			continue
+		}
+		if len(m.Malformed) > 0 {
+			warn("# Not updating %s, which has improperly formatted lines\n", m.Filename)
+			ok = false
+			continue
+		}
+
+		added := 0
+		for _, action := range dropped[filename] {
+			entry, err := action.DroppedEntry()
+			if err != nil {
+				croak(fmt.Errorf("%s: %s", action.Path, err))
+				ok = false
+				continue
+			}
+			if m.Add(entry) {
+				added++
+			}
+		}
+		if added == 0 {
+			continue
+		}
+		if err := m.Save(hv.WriteOptions{Tagged: m.Tagged()}); err != nil {
+			croak(err)
+			ok = false
+			continue
+		}
+		say("# Added %d entries back to %s\n", added, m.Filename)
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"errors"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	// Declared in common:
+	// hashFunction HashValue
+	// cwd string
+	// manifestFile string
+	// base string
+	// silent bool
+	// recursive bool
+	// jobs int
+	// Declared in progress:
+	// stats bool
+	// noProgress bool
+)
+
+var cmdUpdate = &Command{
+	Run: runUpdate,
+	Usage: `update [-s] [-r] [-j=n] [-c=hash] [-D=dir] [-f=file] [--base=dir] [--exclude=pattern] [--include=pattern] [--stats] [--no-progress]`,
+	Short: "Update a checksum file with changed files",
+	Long: `
+Update the checksum file for the given directory in place. Files that are not
+yet in the checksum file are added, files that no longer exist are dropped, and
+files whose size or modification time has changed since the last update are
+hashed again. All other checksums are carried over without reading the files.
+
+The size and modification time of every file are kept in a hidden cache file
+next to the checksum file, named .%sSUMS.cache. If there is no cache yet, every
+file is hashed again. Both files are replaced atomically. A checksum file in the
+BSD or tagged format is written back in that format, and every entry in it is
+hashed again with its own hash function.
+
+With -f, the given checksum file is used instead of the one in the directory,
+and with --base, filenames in it are relative to the given directory instead.
+The checksum file cannot be read from STDIN.
+
+New files are looked for among the top-level files of the directory, or in the
+entire directory tree if -r is given. Every added, updated and removed file is
+written to STDERR unless silent mode is on. The .hvignore file, --exclude and
+--include decide which new files are found the same way as for generate, but
+files that are already in the checksum file are kept regardless.
+
+While files are hashed, the progress is shown on STDERR the same way verify shows
+it, and --stats writes the number of files added, updated and removed, the number
+of files and bytes hashed and the time taken to STDERR at the end.`,
+}
+
+// Initialized in common:
+// var preferredHashes []string
+
+func init() {
+	const (
+		manifestUsage = "the checksum file to use instead of the one in the directory"
+		baseUsage = "the directory that filenames in the checksum file are relative to, if not the directory"
+		silentUsage = "silent; don't output to STDERR"
+		recursiveUsage = "look for new files in subdirectories as well"
+		cwdUsage = "the directory whose checksum file to update"
+		jobsUsage = "the number of files to hash concurrently"
+	)
+	hashUsage := fmt.Sprintf("the hash to use; if unspecified, the following are tried in order: %s", strings.Join(preferredHashes, ", "))
+	f := &cmdUpdate.Flag
+	f.BoolVar(&silent, "s", false, silentUsage)
+	f.BoolVar(&recursive, "r", false, recursiveUsage)
+	f.IntVar(&jobs, "j", 1, jobsUsage)
+	f.Var(&hashFunction, "c", hashUsage)
+	f.StringVar(&cwd, "D", ".", cwdUsage)
+	f.StringVar(&manifestFile, "f", "", manifestUsage)
+	f.StringVar(&base, "base", "", baseUsage)
+	f.Var(&excludes, "exclude", excludeUsage)
+	f.Var(&includes, "include", includeUsage)
+	f.BoolVar(&stats, "stats", false, statsUsage)
+	f.BoolVar(&noProgress, "no-progress", false, progressUsage)
+}
+
+func runUpdate(cmd *Command, args []string) {
+	if manifestFile == "-" {
+		die(errors.New("cannot update a checksum file read from STDIN"))
+	}
+	m := openManifest()
+	tagged := m.Tagged()
+
+	cacheFile := hv.CacheFilename(m.Filename)
+	cache, err := hv.LoadCache(cacheFile)
+	if err != nil {
+		die(err)
+	}
+
+	progress, stop := startProgress()
+	opts := hv.UpdateOptions{WalkOptions: walkOptions(), Jobs: jobs, Progress: progress}
+	changes, stamps, err := m.Update(cache, opts)
+	stop()
+	if err != nil {
+		die(err)
+	}
+
+	if !silent {
+		for _, filename := range changes.Added {
+			marker, names := escapeFilenames(filename)
+			warn("%sadded %s\n", marker, names[0])
+		}
+		for _, filename := range changes.Updated {
+			marker, names := escapeFilenames(filename)
+			warn("%supdated %s\n", marker, names[0])
+		}
+		for _, filename := range changes.Removed {
+			marker, names := escapeFilenames(filename)
+			warn("%sremoved %s\n", marker, names[0])
+		}
+	}
+
+	if err := m.Save(hv.WriteOptions{Tagged: tagged}); err != nil {
+		die(err)
+	}
+
+	if err := hv.DumpCache(cacheFile, stamps); err != nil {
+		die(err)
+	}
+
+	sayStats(progress, fmt.Sprintf("%d added, %d updated, %d removed",
+		len(changes.Added), len(changes.Updated), len(changes.Removed)))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+
+	"github.com/kourge/hv"
+)
+
+var (
+	// Declared in common:
+	// hashFunction HashValue
+	// cwd string
+	// manifestFile string
+	// base string
+	// silent bool
+	// recursive bool
+	// jobs int
+	// outputFormat OutputFormat
+	// strict bool
+	// Declared in progress:
+	// stats bool
+	// noProgress bool
+)
+
+var cmdVerify = &Command{
+	Run: runVerify,
+	Usage: `verify [-s] [-r] [-j=n] [-c=hash] [-D=dir] [-f=file] [--base=dir] [--exclude=pattern] [--include=pattern] [--format=format] [--strict] [--stats] [--no-progress] [file]`,
+	Short: "Verify using a checksum file",
+	Long: `
+Verify all files for the given directory against a checksum file. If a specific
+file is given, only that file is verified.
+
+With -f, the given checksum file is used instead of the one in the directory. It
+may have any name and live anywhere, and - reads it from STDIN. Unless -c is
+given, its hash function is told from the length of its checksums. Filenames in
+the checksum file are relative to the directory, or to the one given by --base.
+
+Lines in the BSD or tagged format, e.g. "SHA256 (file) = checksum", are
+recognized as well, and each such line is verified using the hash function it
+names, regardless of the hash function of the checksum file.
+
+Lines that cannot be parsed, or whose checksum does not have the right number of
+digits for its hash function, are skipped with a warning that gives their line
+number, followed by a count of them, and the exit status is 6 even if every file
+is OK. With --strict, the first such line is fatal instead. If no line at all
+can be parsed, nothing is verified.
+
+Every file is sorted into one of the following classes:
+
+  OK         the file matches its recorded checksum
+  MISMATCH   the file does not match its recorded checksum
+  MISSING    the file is in the checksum file but not on disk
+  UNTRACKED  the file is on disk but not in the checksum file
+  ERROR      the file could not be read for any other reason
+
+Untracked files are looked for among the top-level files of the directory, or in
+the entire directory tree if -r is given. They are not looked for when a specific
+file is given. Files skipped by the .hvignore file or by --exclude, but not
+brought back by --include, are not untracked; see generate for how these work.
+Files that are in the checksum file are verified regardless.
+
+Every file that is not OK is written to STDERR, followed by a summary of the
+number of files in each class, unless silent mode is on. The exit status tells
+the most severe class found:
+
+  0  all files are OK
+  1  at least one file is MISMATCH
+  3  at least one file is MISSING, but none are MISMATCH or ERROR
+  4  at least one file is UNTRACKED, but all others are OK
+  5  at least one file is ERROR, but none are MISMATCH
+  6  a line of the checksum file is improperly formatted, but no file is
+     MISMATCH or ERROR
+
+Any other trouble, such as a checksum file that cannot be read, exits 1 as well,
+after saying so on STDERR.
+
+With --format=json or --format=ndjson, a record for every file, including the
+ones that are OK, is written to STDOUT instead, with the file's expected and
+actual checksum, its class as the status, and the error if there is one.
+
+Files are hashed by up to n concurrent workers when -j is given. Findings are
+always reported in the order in which they appear in the checksum file.
+
+While files are hashed, the number of files and bytes done so far, the total
+number of bytes, the throughput and the estimated time left are shown on STDERR,
+unless STDERR is not a terminal, silent mode is on or --no-progress is given.
+With --stats, the summary is written to STDERR even in silent mode, along with
+the number of files and bytes hashed and the time taken.`,
+}
+
+// Initialized in common:
+// var preferredHashes []string
+
+// The exit status of verify when s is the most severe class found.
+func exitStatus(s hv.Status) int {
+	switch s {
+	case hv.StatusOK: return 0
+	case hv.StatusMissing: return 3
+	case hv.StatusUntracked: return 4
+	case hv.StatusError: return 5
+	default: return 1
+	}
+}
+
+// The exit status of verify when the checksum file has improperly formatted
+// lines, unless a file is MISMATCH or ERROR.
+const malformedStatus = 6
+
+func init() {
+	const (
+		manifestUsage = "the checksum file to use instead of the one in the directory, or - for STDIN"
+		baseUsage = "the directory that filenames in the checksum file are relative to, if not the directory"
+		silentUsage = "silent; don't output to STDERR"
+		recursiveUsage = "look for untracked files in subdirectories as well"
+		cwdUsage = "the directory to verify using its checksum file"
+		jobsUsage = "the number of files to hash concurrently"
+	)
+	strictUsage := "fail on the first improperly formatted line of the checksum file"
+	formatUsage := fmt.Sprintf("the output format: %s", strings.Join(outputFormat.Values(), ", "))
+	hashUsage := fmt.Sprintf("the hash to use; if unspecified, the following are tried in order: %s", strings.Join(preferredHashes, ", "))
+	f := &cmdVerify.Flag
+	f.BoolVar(&silent, "s", false, silentUsage)
+	f.BoolVar(&recursive, "r", false, recursiveUsage)
+	f.IntVar(&jobs, "j", 1, jobsUsage)
+	f.Var(&hashFunction, "c", hashUsage)
+	f.StringVar(&cwd, "D", ".", cwdUsage)
+	f.StringVar(&manifestFile, "f", "", manifestUsage)
+	f.StringVar(&base, "base", "", baseUsage)
+	f.Var(&excludes, "exclude", excludeUsage)
+	f.Var(&includes, "include", includeUsage)
+	f.Var(&outputFormat, "format", formatUsage)
+	f.BoolVar(&strict, "strict", false, strictUsage)
+	f.BoolVar(&stats, "stats", false, statsUsage)
+	f.BoolVar(&noProgress, "no-progress", false, progressUsage)
+}
+
+func runVerify(cmd *Command, args []string) {
+	m, err := loadManifest()
+	var malformed *hv.ParseError
+	if errors.As(err, &malformed) {
+		croak(err)
+		exit(malformedStatus)
+	} else if err != nil {
+		die(err)
+	}
+	if len(m.Entries) == 0 && len(m.Malformed) > 0 {
+		croak(fmt.Errorf("%s: no properly formatted checksum lines found", m.Filename))
+		exit(malformedStatus)
+	}
+	singleFileMode, singleFile := false, ""
+	if len(args) == 1 {
+		singleFileMode = true
+		singleFile = args[0]
+	}
+
+	if singleFileMode {
+		entries := make(hv.Entries, 0, 1)
+		for _, entry := range m.Entries {
+			if entry.Filename == singleFile {
+				entries = append(entries, entry)
+			}
+		}
+		m.Entries = entries
+	}
+
+	progress, stop := startProgress()
+	opts := hv.VerifyOptions{WalkOptions: walkOptions(), Untracked: !singleFileMode, Jobs: jobs, Progress: progress}
+	results, err := m.Verify(opts)
+	stop()
+	if err != nil {
+		die(err)
+	}
+
+	counts := make(map[hv.Status]int)
+	worst := hv.StatusOK
+	for _, result := range results {
+		status, entry, err := result.Status, result.Entry, result.Err
+		counts[status]++
+		if status.MoreSevere(worst) {
+			worst = status
+		}
+		emit(&Record{
+			File: entry.Filename,
+			Expected: entry.Checksum,
+			Actual: result.Actual,
+			Status: status.String(),
+			Error: errorString(err),
+		})
+		if silent || status == hv.StatusOK {
+			continue
+		}
+		marker, names := escapeFilenames(entry.Filename)
+		if err != nil {
+			say("%s%-9s  %s: %s\n", marker, status, names[0], err)
+		} else {
+			say("%s%-9s  %s\n", marker, status, names[0])
+		}
+	}
+
+	summary := fmt.Sprintf("%d OK, %d mismatched, %d missing, %d untracked, %d unreadable",
+		counts[hv.StatusOK], counts[hv.StatusMismatch], counts[hv.StatusMissing],
+		counts[hv.StatusUntracked], counts[hv.StatusError])
+	if stats {
+		sayStats(progress, summary)
+	} else if !silent {
+		say("%s\n", summary)
+	}
+
+	status := exitStatus(worst)
+	if len(m.Malformed) > 0 && !worst.MoreSevere(hv.StatusMissing) {
+		status = malformedStatus
+	}
+	exit(status)
+}
@@ -0,0 +1,74 @@
+package hv
+
+import (
+	"sort"
+	"strings"
+)
+
+// A file that is only in the new checksum file but has the same checksum as a
+// file that is only in the old one.
+type Rename struct {
+	From string
+	To string
+}
+
+// How one checksum file differs from another. Every list is sorted by filename,
+// and Renamed by the new filename.
+type Difference struct {
+	Added []string
+	Removed []string
+	Modified []string
+	Renamed []Rename
+}
+
+func (d *Difference) Empty() bool {
+	return len(d.Added) + len(d.Removed) + len(d.Modified) + len(d.Renamed) == 0
+}
+
+// Compare two checksum files, loaded as maps from filename to checksum. A file
+// that is only in after but has the checksum of a file that is only in before
+// is taken to be that file renamed. If several files only in before share that
+// checksum, they are paired with the files only in after in filename order.
+// Checksums are compared regardless of case.
+func Diff(before, after map[string]string) (d Difference) {
+	var added, removed []string
+	for filename, checksum := range after {
+		if oldChecksum, exists := before[filename]; !exists {
+			added = append(added, filename)
+		} else if !strings.EqualFold(checksum, oldChecksum) {
+			d.Modified = append(d.Modified, filename)
+		}
+	}
+	for filename := range before {
+		if _, exists := after[filename]; !exists {
+			removed = append(removed, filename)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(d.Modified)
+
+	gone := make(map[string][]string)
+	for _, filename := range removed {
+		checksum := strings.ToLower(before[filename])
+		gone[checksum] = append(gone[checksum], filename)
+	}
+
+	renamed := make(map[string]bool)
+	for _, filename := range added {
+		checksum := strings.ToLower(after[filename])
+		if from := gone[checksum]; len(from) > 0 {
+			d.Renamed = append(d.Renamed, Rename{From: from[0], To: filename})
+			gone[checksum] = from[1:]
+			renamed[from[0]] = true
+		} else {
+			d.Added = append(d.Added, filename)
+		}
+	}
+	for _, filename := range removed {
+		if !renamed[filename] {
+			d.Removed = append(d.Removed, filename)
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package hv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		before, after map[string]string
+		want Difference
+	}{
+		{
+			name: "same",
+			before: map[string]string{"a": "01", "b": "02"},
+			after: map[string]string{"a": "01", "b": "02"},
+		},
+		{
+			name: "added, removed and modified",
+			before: map[string]string{"a": "01", "b": "02", "c": "03"},
+			after: map[string]string{"a": "01", "b": "ff", "d": "04"},
+			want: Difference{Added: []string{"d"}, Removed: []string{"c"}, Modified: []string{"b"}},
+		},
+		{
+			name: "renamed",
+			before: map[string]string{"old": "01"},
+			after: map[string]string{"new": "01"},
+			want: Difference{Renamed: []Rename{{From: "old", To: "new"}}},
+		},
+		{
+			name: "renamed regardless of case",
+			before: map[string]string{"old": "AB"},
+			after: map[string]string{"new": "ab"},
+			want: Difference{Renamed: []Rename{{From: "old", To: "new"}}},
+		},
+		{
+			name: "modified regardless of case",
+			before: map[string]string{"a": "AB"},
+			after: map[string]string{"a": "ab"},
+		},
+		{
+			name: "several renamed with one checksum are paired in order",
+			before: map[string]string{"y": "01", "x": "01", "z": "01"},
+			after: map[string]string{"b": "01", "a": "01"},
+			want: Difference{
+				Removed: []string{"z"},
+				Renamed: []Rename{{From: "x", To: "a"}, {From: "y", To: "b"}},
+			},
+		},
+		{
+			name: "more new files than old ones with a checksum",
+			before: map[string]string{"x": "01"},
+			after: map[string]string{"b": "01", "a": "01"},
+			want: Difference{Added: []string{"b"}, Renamed: []Rename{{From: "x", To: "a"}}},
+		},
+		{
+			name: "a copy is added, not renamed",
+			before: map[string]string{"a": "01"},
+			after: map[string]string{"a": "01", "copy": "01"},
+			want: Difference{Added: []string{"copy"}},
+		},
+	}
+
+	for _, test := range tests {
+		d := Diff(test.before, test.after)
+		if !reflect.DeepEqual(d, test.want) {
+			t.Errorf("%s: Diff() = %+v, want %+v", test.name, d, test.want)
+		}
+		if d.Empty() != reflect.DeepEqual(test.want, Difference{}) {
+			t.Errorf("%s: Empty() = %v", test.name, d.Empty())
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package hv
+
+import (
+	"os"
+	"io"
+	"sort"
+	"crypto"
+	"container/list"
+)
+
+// The number of bytes at either end of a file that are hashed to tell files of
+// the same size apart before hashing them in full.
+const PartialSize int64 = 4096
+
+// Options that control how duplicates are found.
+type DupesOptions struct {
+	WalkOptions
+	// The hash function to checksum duplicates with.
+	Hash HashValue
+	// The number of files to hash concurrently.
+	Jobs int
+	// Whether to count empty files as duplicates of each other.
+	Empty bool
+}
+
+// A set of files that are byte-by-byte identical.
+type Duplicates struct {
+	Checksum string
+	Size int64
+	// Slash-separated and relative to the directory that was searched, in order.
+	Filenames []string
+}
+
+// The entries of d, as they would appear in a checksum file for h.
+func (d *Duplicates) Entries(h HashValue) Entries {
+	entries := make(Entries, len(d.Filenames))
+	for i, filename := range d.Filenames {
+		entries[i] = &Entry{Checksum: d.Checksum, Filename: filename, Hash: h.Hash}
+	}
+	return entries
+}
+
+// Find every set of identical files in the directory root without a checksum
+// file. Reading as little as possible, files are grouped by size, then by a
+// checksum of their first and last PartialSize bytes, then by a checksum of
+// their whole content, and finally compared byte by byte. Sets are sorted by
+// checksum. Files that cannot be read are left out, and their errors returned.
+// If opts.Hash is not available, that is the only error.
+func FindDuplicates(root string, opts DupesOptions) (sets []*Duplicates, errs []error) {
+	if !opts.Hash.Available() {
+		return nil, []error{HashUnavailableError{opts.Hash.Hash}}
+	}
+
+	entries, err := EntriesFromPath(root, opts.WalkOptions)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	filenames := list.New()
+	for _, entry := range entries {
+		filenames.PushBack(entry.Filename)
+	}
+	bySize := GroupBySize(root, filenames)
+	if group, exists := bySize[-1]; exists {
+		for e := group.Front(); e != nil; e = e.Next() {
+			errs = append(errs, e.Value.(error))
+		}
+		delete(bySize, -1)
+	}
+
+	var groups [][]*LazyFile
+	for _, size := range sortedSizes(bySize) {
+		group := bySize[size]
+		if group.Len() < 2 || (size == 0 && !opts.Empty) {
+			continue
+		}
+		files := make([]*LazyFile, 0, group.Len())
+		for e := group.Front(); e != nil; e = e.Next() {
+			files = append(files, e.Value.(*LazyFile))
+		}
+		groups = append(groups, files)
+	}
+
+	h := opts.Hash.Hash
+	groups, _, errs = regroup(groups, opts.Jobs, errs, func(file *LazyFile) (string, error) {
+		return partialChecksum(file, h)
+	})
+	var checksums map[*LazyFile]string
+	groups, checksums, errs = regroup(groups, opts.Jobs, errs, func(file *LazyFile) (string, error) {
+		entry := &Entry{Filename: file.Filename}
+		sum, err := entry.Calculate(root, h)
+		return formatChecksum(h, sum), err
+	})
+
+	for _, files := range groups {
+		identical := list.New()
+		for _, file := range files {
+			identical.PushBack(file)
+		}
+		buckets, e := GroupByContent(identical)
+		errs = append(errs, e...)
+		for _, bucket := range buckets {
+			if len(bucket.Files) < 2 {
+				continue
+			}
+			d := &Duplicates{Checksum: checksums[bucket.Files[0]], Size: bucket.Files[0].Size()}
+			for _, file := range bucket.Files {
+				d.Filenames = append(d.Filenames, file.Filename)
+			}
+			sets = append(sets, d)
+		}
+		for _, file := range files {
+			file.Close()
+		}
+	}
+
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Checksum != sets[j].Checksum {
+			return sets[i].Checksum < sets[j].Checksum
+		}
+		return sets[i].Filenames[0] < sets[j].Filenames[0]
+	})
+	return
+}
+
+// Split every group of files further by the key of each file, computed by up to
+// jobs goroutines at a time, and keep only the parts that still hold more than
+// one file. Files whose key cannot be computed are left out, and their errors
+// appended to errs. Returns the key of every file that is kept as well.
+func regroup(groups [][]*LazyFile, jobs int, errs []error, key func(*LazyFile) (string, error)) ([][]*LazyFile, map[*LazyFile]string, []error) {
+	var files []*LazyFile
+	for _, group := range groups {
+		files = append(files, group...)
+	}
+
+	results := make([]string, len(files))
+	failures := make([]error, len(files))
+	parallel(len(files), jobs, func(i int) {
+		results[i], failures[i] = key(files[i])
+	})
+
+	var regrouped [][]*LazyFile
+	keys := make(map[*LazyFile]string)
+	i := 0
+	for _, group := range groups {
+		parts := make(map[string][]*LazyFile)
+		var order []string
+		for _, file := range group {
+			if err := failures[i]; err != nil {
+				errs = append(errs, err)
+			} else {
+				k := results[i]
+				if _, exists := parts[k]; !exists {
+					order = append(order, k)
+				}
+				parts[k] = append(parts[k], file)
+				keys[file] = k
+			}
+			i++
+		}
+		for _, k := range order {
+			if len(parts[k]) > 1 {
+				regrouped = append(regrouped, parts[k])
+			}
+		}
+	}
+	return regrouped, keys, errs
+}
+
+// A checksum of the first and last PartialSize bytes of file, or of all of it
+// if it is no larger than that.
+func partialChecksum(file *LazyFile, h crypto.Hash) (string, error) {
+	f, err := os.Open(file.path())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := h.New()
+	size := file.Size()
+	if size <= 2 * PartialSize {
+		_, err = io.Copy(hash, f)
+	} else if _, err = io.Copy(hash, io.NewSectionReader(f, 0, PartialSize)); err == nil {
+		_, err = io.Copy(hash, io.NewSectionReader(f, size - PartialSize, PartialSize))
+	}
+	if err != nil {
+		return "", err
+	}
+	return formatChecksum(h, hash.Sum(nil)), nil
+}
@@ -0,0 +1,31 @@
+package hv
+
+import (
+	"os"
+	"crypto"
+	"testing"
+	"io/ioutil"
+)
+
+func TestFindDuplicatesHashUnavailable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string][]byte{"a": []byte("same\n"), "b": []byte("same\n")})
+
+	for _, h := range []crypto.Hash{0x0, crypto.MD4} {
+		sets, errs := FindDuplicates(dir, DupesOptions{Hash: HashValue{h}})
+		if len(sets) != 0 || len(errs) != 1 {
+			t.Errorf("%v: found %v and %v, want one error", h, sets, errs)
+		} else if _, ok := errs[0].(HashUnavailableError); !ok {
+			t.Errorf("%v: fails with %v, want a HashUnavailableError", h, errs[0])
+		}
+	}
+
+	sets, errs := FindDuplicates(dir, DupesOptions{Hash: HashValue{crypto.SHA1}})
+	if len(sets) != 1 || len(errs) != 0 {
+		t.Errorf("SHA1: found %v and %v, want one set", sets, errs)
+	}
+}
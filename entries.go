@@ -1,20 +1,101 @@
-package main
+package hv
 
 import (
 	"os"
 	"io/ioutil"
 	"container/list"
+	"path/filepath"
 	"strings"
+	"sort"
 )
 
 type Entries []*Entry
 
-func EntriesFromPath(path string) (entries Entries, err error) {
-	files, err := ioutil.ReadDir(cwd)
+// Options that control which files are found in a directory.
+type WalkOptions struct {
+	// Whether to descend into subdirectories.
+	Recursive bool
+	// Paths of files to leave out regardless, such as a checksum file that does
+	// not follow the usual naming.
+	Ignore []string
+	// Gitignore-style patterns of files and directories to leave out, on top of
+	// the ones in the directory's IgnoreFilename.
+	Exclude []string
+	// Gitignore-style patterns of files and directories to find even if they
+	// would otherwise be left out, such as hidden ones.
+	Include []string
+}
+
+// Return an entry for every file in the directory path that matches. Filenames
+// are slash-separated and relative to path.
+func EntriesFromPath(path string, opts WalkOptions) (entries Entries, err error) {
+	f, err := newFilter(path, opts)
 	if err != nil {
 		return
 	}
-	return EntriesFromFiles(files), nil
+
+	if opts.Recursive {
+		entries, err = walkTree(path, f)
+	} else {
+		var files []os.FileInfo
+		if files, err = ioutil.ReadDir(path); err == nil {
+			entries = filterFiles(files, f)
+		}
+	}
+	if err != nil || len(opts.Ignore) == 0 {
+		return
+	}
+
+	ignored := make(map[string]bool)
+	for _, p := range opts.Ignore {
+		if abs, err := filepath.Abs(p); err == nil {
+			ignored[abs] = true
+		}
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if abs, err := filepath.Abs(entry.Path(path)); err != nil || !ignored[abs] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// Walk the directory tree rooted at path and return an entry for every file
+// that matches, named by its slash-separated path relative to the root. Hidden
+// directories are not descended into, and neither are the files and directories
+// that f excludes.
+func walkTree(path string, f filter) (entries Entries, err error) {
+	entries = make([]*Entry, 0)
+	err = filepath.Walk(path, func(p string, file os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == path {
+			return nil
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if file.IsDir() {
+			if f.excludes(rel, true, strings.HasPrefix(file.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !file.Mode().IsRegular() || f.excludes(rel, false, !matches(file)) {
+			return nil
+		}
+		entries = append(entries, &Entry{Filename: rel})
+		return nil
+	})
+	return
 }
 
 func matches(file os.FileInfo) bool {
@@ -24,10 +105,15 @@ func matches(file os.FileInfo) bool {
 }
 
 func EntriesFromFiles(files []os.FileInfo) Entries {
+	return filterFiles(files, nil)
+}
+
+// Like EntriesFromFiles, but leave out the files that f excludes.
+func filterFiles(files []os.FileInfo, f filter) Entries {
 	items := 0
 	entries := make([]*Entry, len(files))
 	for _, file := range files {
-		if matches(file) {
+		if file.Mode().IsRegular() && !f.excludes(file.Name(), false, !matches(file)) {
 			entry := &Entry{Filename: file.Name()}
 			entries[items] = entry
 			items++
@@ -37,20 +123,17 @@ func EntriesFromFiles(files []os.FileInfo) Entries {
 	return entries[0:items]
 }
 
-func EntriesFromChecksumFile(checksums *os.File) (entries Entries, err error) {
-	entries = make([]*Entry, 0)
-	r := NewReader(checksums)
-	err = r.Each(func(entry *Entry) {
-		entries = append(entries, entry)
-	})
-	return
-}
-
+// Lists of filenames keyed by the checksum that they share. Every list is
+// sorted by filename.
 type BucketsByChecksum map[string]*list.List
 
 func (entries Entries) BucketsByChecksum() (buckets BucketsByChecksum) {
+	sorted := make(Entries, len(entries))
+	copy(sorted, entries)
+	sort.Stable(byFilename(sorted))
+
 	buckets = make(map[string]*list.List)
-	for _, entry := range entries {
+	for _, entry := range sorted {
 		bucket, exists := buckets[entry.Checksum]
 		if !exists {
 			bucket = list.New()
@@ -61,3 +144,19 @@ func (entries Entries) BucketsByChecksum() (buckets BucketsByChecksum) {
 	return
 }
 
+// The checksums of buckets in ascending order, so that buckets can be visited
+// in the same order on every run.
+func (buckets BucketsByChecksum) Checksums() []string {
+	checksums := make([]string, 0, len(buckets))
+	for checksum := range buckets {
+		checksums = append(checksums, checksum)
+	}
+	sort.Strings(checksums)
+	return checksums
+}
+
+type byFilename Entries
+
+func (s byFilename) Len() int { return len(s) }
+func (s byFilename) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byFilename) Less(i, j int) bool { return s[i].Filename < s[j].Filename }
@@ -1,52 +1,161 @@
-package main
+package hv
 
 import (
 	"os"
 	"io"
 	"fmt"
 	"crypto"
+	"hash"
+	"strings"
 )
 
 type Entry struct {
 	Checksum string
 	Filename string
+	// The hash function that produced Checksum, if known. Entries read from a
+	// tagged checksum file carry their own hash function; for all others, the
+	// hash function is implied by the checksum file they belong to.
+	Hash crypto.Hash
+	// Whether the entry is marked as having been read in binary mode, i.e. with
+	// a "*" in front of its filename.
+	Binary bool
 }
 
+// The entry in the GNU format, e.g. "checksum  file". Filenames that contain a
+// backslash or a line break are escaped the way GNU coreutils does it.
 func (e *Entry) String() string {
-	return fmt.Sprintf("%s  %s", e.Checksum, e.Filename)
+	marker, filename := EscapeFilename(e.Filename)
+	separator := Separator
+	if e.Binary {
+		separator = BinarySeparator
+	}
+	return fmt.Sprintf("%s%s%s%s", marker, e.Checksum, separator, filename)
+}
+
+// The entry in the BSD or tagged format, e.g. "SHA256 (file) = checksum".
+func (e *Entry) TaggedString() string {
+	h := &HashValue{e.Hash}
+	marker, filename := EscapeFilename(e.Filename)
+	return fmt.Sprintf("%s%s (%s) = %s", marker, h, filename, e.Checksum)
+}
+
+var filenameEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+
+// Escape the characters in filename that cannot appear as-is in a checksum
+// file, or in a report about it. If any were escaped, marker is the
+// EscapeMarker that has to start its line.
+func EscapeFilename(filename string) (marker string, escaped string) {
+	if !strings.ContainsAny(filename, "\\\n\r") {
+		return "", filename
+	}
+	return EscapeMarker, filenameEscaper.Replace(filename)
+}
+
+// Undo EscapeFilename. Returns false if escaped contains an unknown escape.
+func unescapeFilename(escaped string) (filename string, ok bool) {
+	var b strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		c := escaped[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		if i++; i == len(escaped) {
+			return "", false
+		}
+		switch escaped[i] {
+		case '\\': b.WriteByte('\\')
+		case 'n': b.WriteByte('\n')
+		case 'r': b.WriteByte('\r')
+		default: return "", false
+		}
+	}
+	return b.String(), true
 }
 
-func (e *Entry) Calculate(h crypto.Hash) (sum []byte, err error) {
-	if !h.Available() {
-		return nil, HashUnavailableError{h}
+// The hash function that produced the entry's checksum, or h if it is unknown.
+func (e *Entry) HashOr(h crypto.Hash) crypto.Hash {
+	if e.Hash == 0x0 {
+		return h
 	}
-	hash := h.New()
+	return e.Hash
+}
 
-	if file, err := os.Open(e.Filename); err != nil {
+// The path of the entry's file, converted from the slash-separated form used in
+// checksum files to one suitable for the host operating system and joined to
+// root, the directory that the checksum file's filenames are relative to.
+func (e *Entry) Path(root string) string {
+	return FilePath(root, e.Filename)
+}
+
+func (e *Entry) Calculate(root string, h crypto.Hash) (sum []byte, err error) {
+	sums, err := e.CalculateAll(root, []crypto.Hash{h})
+	if err != nil {
 		return nil, err
-	} else if _, err = io.Copy(hash, file); err != nil {
+	}
+	return sums[0], nil
+}
+
+// Calculate the checksum of the entry's file for every hash function in hs,
+// reading the file only once. The sums are in the same order as hs.
+func (e *Entry) CalculateAll(root string, hs []crypto.Hash) (sums [][]byte, err error) {
+	return e.calculateAll(root, hs, nil)
+}
+
+// Like CalculateAll, but count the bytes read towards progress, if any.
+func (e *Entry) calculateAll(root string, hs []crypto.Hash, progress *Progress) (sums [][]byte, err error) {
+	hashes := make([]hash.Hash, len(hs))
+	writers := make([]io.Writer, len(hs), len(hs) + 1)
+	for i, h := range hs {
+		if !h.Available() {
+			return nil, HashUnavailableError{h}
+		}
+		hashes[i] = h.New()
+		writers[i] = hashes[i]
+	}
+	if progress != nil {
+		writers = append(writers, progressWriter{progress})
+	}
+
+	file, err := os.Open(e.Path(root))
+	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	return hash.Sum(nil), nil
+	if _, err = io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return nil, err
+	}
+
+	sums = make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		sums[i] = hash.Sum(nil)
+	}
+	return sums, nil
 }
 
 func formatChecksum(h crypto.Hash, sum []byte) string {
 	return fmt.Sprintf("%x", sum)
 }
 
-func (e *Entry) Fill(h crypto.Hash) (err error) {
-	sum, err := e.Calculate(h)
+func (e *Entry) Fill(root string, h crypto.Hash) (err error) {
+	return e.fill(root, h, nil)
+}
+
+func (e *Entry) fill(root string, h crypto.Hash, progress *Progress) (err error) {
+	sums, err := e.calculateAll(root, []crypto.Hash{h}, progress)
 	if err != nil {
 		return
 	}
 
-	e.Checksum = formatChecksum(h, sum)
+	e.Checksum = formatChecksum(h, sums[0])
+	e.Hash = h
 	return
 }
 
-func (e *Entry) Verify(h crypto.Hash) (match bool, err error) {
-	sum, err := e.Calculate(h)
+func (e *Entry) Verify(root string, h crypto.Hash) (match bool, err error) {
+	sum, err := e.Calculate(root, h)
 	if err != nil {
 		return
 	}
@@ -54,4 +163,3 @@ func (e *Entry) Verify(h crypto.Hash) (match bool, err error) {
 	match = formatChecksum(h, sum) == e.Checksum
 	return
 }
-
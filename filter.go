@@ -0,0 +1,148 @@
+package hv
+
+import (
+	"os"
+	"fmt"
+	"bufio"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the file in a directory that lists patterns of files to leave out
+// when the directory is walked, one per line, in the style of .gitignore.
+const IgnoreFilename = ".hvignore"
+
+// A gitignore-style pattern. A pattern that contains a slash other than at its
+// end is anchored to the directory being walked, and any other pattern matches
+// a file or directory by its name alone. A trailing slash makes it only match
+// directories, a leading "!" negates it, and "**" matches any number of path
+// components.
+type pattern struct {
+	glob string
+	negated bool
+	dirOnly bool
+	anchored bool
+}
+
+func parsePattern(line string) (p pattern, err error) {
+	if strings.HasPrefix(line, "!") {
+		p.negated, line = true, line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored, line = true, strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return p, fmt.Errorf("empty pattern")
+	}
+	if _, err := path.Match(line, ""); err != nil {
+		return p, fmt.Errorf("bad pattern %q", line)
+	}
+	p.glob = line
+	return
+}
+
+// Whether p matches the file or directory named by the slash-separated path
+// rel, which is relative to the directory being walked.
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		matched, _ := path.Match(p.glob, path.Base(rel))
+		return matched
+	}
+	return matchComponents(strings.Split(p.glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchComponents(globs []string, names []string) bool {
+	for len(globs) > 0 {
+		if globs[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matchComponents(globs[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(globs[0], names[0]); !matched {
+			return false
+		}
+		globs, names = globs[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// Patterns in the order they apply; the last one to match a path decides it.
+type filter []pattern
+
+// The patterns that apply when the directory root is walked with opts: those in
+// root's IgnoreFilename, if there is one, then opts.Exclude, then opts.Include
+// negated, so that an include wins over everything else.
+func newFilter(root string, opts WalkOptions) (f filter, err error) {
+	if f, err = readIgnoreFile(filepath.Join(root, IgnoreFilename)); err != nil {
+		return
+	}
+
+	for _, line := range opts.Exclude {
+		p, err := parsePattern(line)
+		if err != nil {
+			return nil, err
+		}
+		f = append(f, p)
+	}
+	for _, line := range opts.Include {
+		p, err := parsePattern(line)
+		if err != nil {
+			return nil, err
+		}
+		p.negated = !p.negated
+		f = append(f, p)
+	}
+	return
+}
+
+// Read the patterns in filename. Blank lines and lines starting with "#" are
+// skipped. A file that does not exist has no patterns.
+func readIgnoreFile(filename string) (f filter, err error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parsePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %s", filename, n, err)
+		}
+		f = append(f, p)
+	}
+	return f, scanner.Err()
+}
+
+// Whether the file or directory named by the slash-separated path rel is left
+// out, given whether the usual rules leave it out.
+func (f filter) excludes(rel string, isDir bool, excluded bool) bool {
+	for _, p := range f {
+		if p.match(rel, isDir) {
+			excluded = !p.negated
+		}
+	}
+	return excluded
+}
@@ -0,0 +1,128 @@
+package hv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		line string
+		want pattern
+		err bool
+	}{
+		{"*.tmp", pattern{glob: "*.tmp"}, false},
+		{"!keep.tmp", pattern{glob: "keep.tmp", negated: true}, false},
+		{`\!bang`, pattern{glob: "!bang"}, false},
+		{`\#hash`, pattern{glob: "#hash"}, false},
+		{"build/", pattern{glob: "build", dirOnly: true}, false},
+		{"/top", pattern{glob: "top", anchored: true}, false},
+		{"a/b", pattern{glob: "a/b", anchored: true}, false},
+		{"!/a/**/b/", pattern{glob: "a/**/b", negated: true, dirOnly: true, anchored: true}, false},
+		{"/", pattern{}, true},
+		{"!", pattern{}, true},
+		{"[", pattern{}, true},
+	}
+
+	for _, test := range tests {
+		p, err := parsePattern(test.line)
+		if test.err {
+			if err == nil {
+				t.Errorf("parsePattern(%q) = %+v, want an error", test.line, p)
+			}
+		} else if err != nil {
+			t.Errorf("parsePattern(%q) fails: %s", test.line, err)
+		} else if p != test.want {
+			t.Errorf("parsePattern(%q) = %+v, want %+v", test.line, p, test.want)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel string
+		isDir bool
+		match bool
+	}{
+		{"*.tmp", "a.tmp", false, true},
+		{"*.tmp", "deep/down/a.tmp", false, true},
+		{"*.tmp", "a.tmp.txt", false, false},
+		{"build/", "src/build", true, true},
+		{"build/", "src/build", false, false},
+		{"/top", "top", false, true},
+		{"/top", "sub/top", false, false},
+		{"a/*.c", "a/x.c", false, true},
+		{"a/*.c", "a/b/x.c", false, false},
+		{"a/**/x.c", "a/x.c", false, true},
+		{"a/**/x.c", "a/b/c/x.c", false, true},
+		{"a/**/x.c", "b/a/x.c", false, false},
+		{"**/x.c", "x.c", false, true},
+		{"**/x.c", "b/x.c", false, true},
+		{"a/**", "a/b/c", false, true},
+		{"a/**", "a", true, true},
+		{"a/**", "ab/c", false, false},
+	}
+
+	for _, test := range tests {
+		p, err := parsePattern(test.pattern)
+		if err != nil {
+			t.Fatalf("parsePattern(%q) fails: %s", test.pattern, err)
+		}
+		if match := p.match(test.rel, test.isDir); match != test.match {
+			t.Errorf("%q matches %q (directory: %v) = %v, want %v", test.pattern, test.rel, test.isDir, match, test.match)
+		}
+	}
+}
+
+func TestMatchComponents(t *testing.T) {
+	tests := []struct {
+		glob string
+		name string
+		match bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+		{"a/b/c", "a/b", false},
+		{"**", "a/b/c", true},
+		{"**/**/c", "c", true},
+		{"a/**/**/d", "a/b/c/d", true},
+		{"a/*/d", "a/b/c/d", false},
+		{"a/**/c/**/e", "a/b/c/d/e", true},
+		{"a/**/c/**/e", "a/b/d/e", false},
+	}
+
+	for _, test := range tests {
+		match := matchComponents(strings.Split(test.glob, "/"), strings.Split(test.name, "/"))
+		if match != test.match {
+			t.Errorf("matchComponents(%q, %q) = %v, want %v", test.glob, test.name, match, test.match)
+		}
+	}
+}
+
+func TestFilterLastMatchWins(t *testing.T) {
+	var f filter
+	for _, line := range []string{"*.log", "!keep.log", "logs/"} {
+		p, err := parsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f = append(f, p)
+	}
+
+	tests := []struct {
+		rel string
+		isDir bool
+		excluded bool
+	}{
+		{"a.log", false, true},
+		{"keep.log", false, false},
+		{"a.txt", false, false},
+		{"logs", true, true},
+	}
+	for _, test := range tests {
+		if excluded := f.excludes(test.rel, test.isDir, false); excluded != test.excluded {
+			t.Errorf("excludes(%q) = %v, want %v", test.rel, excluded, test.excluded)
+		}
+	}
+}
@@ -1,86 +1,109 @@
-package main
+package hv
 
 import (
-	"os"
 	"fmt"
-	"strings"
-	"errors"
+	"crypto"
+	"path/filepath"
 )
 
-var (
-	force bool
-	// Declared in common:
-	// hashFunction HashValue
-	// cwd string
-)
+// Options that control how a checksum file is generated.
+type GenerateOptions struct {
+	WalkOptions
+	// The number of files to hash concurrently.
+	Jobs int
+	// Where to count the files and bytes hashed so far, if anywhere.
+	Progress *Progress
+	// Whether to leave out files that cannot be hashed instead of failing.
+	KeepGoing bool
+	// The order of the entries.
+	Sort SortOrder
+}
 
-var cmdGenerate = &Command{
-	Run: runGenerate,
-	Usage: `generate [-f] [-c=hash] [-D=dir] [-]`,
-	Short: "Generate a checksum file",
-	Long: `
-Generate a checksum file for the given directory. The generated checksum file
-will be named %sSUMS, where %s is the chosen hash function name in all caps.
-All top-level files will be accounted for; this process is not recursive.
+// The errors for every file that could not be hashed, in the order in which the
+// files were found.
+type Failures []error
 
-Specifying - as the last argument will print the checksum file to STDOUT instead
-of writing it to a file.`,
+func (f Failures) Error() string {
+	if len(f) == 1 {
+		return f[0].Error()
+	}
+	return fmt.Sprintf("%d files could not be hashed", len(f))
 }
 
-func init() {
-	const (
-		forceUsage = "overwrite an existing checksum file"
-		cwdUsage = "the directory for which to generate the checksum file"
-	)
-	hashUsage := fmt.Sprintf("the hash function to use, e.g. %s", strings.Join(hashFunction.Values(), ", "))
-	f := &cmdGenerate.Flag
-	f.BoolVar(&force, "f", false, forceUsage)
-	f.Var(&hashFunction, "c", hashUsage)
-	f.StringVar(&cwd, "D", ".", cwdUsage)
+// Hash every matching file in the directory root into a new manifest for hash,
+// which is to be saved as root's checksum file. If any file cannot be hashed,
+// the error for the first one is returned, unless opts.KeepGoing is set, in
+// which case such files are left out and the manifest is returned along with
+// the Failures.
+func Generate(root string, hash HashValue, opts GenerateOptions) (m *Manifest, err error) {
+	manifests, err := GenerateAll(root, []HashValue{hash}, opts)
+	if manifests != nil {
+		m = manifests[0]
+	}
+	return
 }
 
-func runGenerate(cmd *Command, args []string) {
-	if err := os.Chdir(cwd); err != nil {
-		die(err)
+// Like Generate, but produce a manifest for every hash function in hashes while
+// reading every file only once. The manifests are in the same order as hashes.
+func GenerateAll(root string, hashes []HashValue, opts GenerateOptions) (manifests []*Manifest, err error) {
+	entries, err := EntriesFromPath(root, opts.WalkOptions)
+	if err != nil {
+		return
 	}
-
-	hash := &hashFunction
-	if hash.String() == "" {
-		hash.Set("SHA1")
+	if err = opts.Sort.Sort(root, entries); err != nil {
+		return
 	}
 
-	var f *os.File
-	if len(args) > 0 && args[0] == "-" {
-		f = os.Stdout
-	} else {
-		var err error
-		checksumFile := hash.Filename()
-		if _, err := os.Stat(checksumFile); err == nil && !force {
-			die(errors.New(fmt.Sprintf("%s already exists", checksumFile)))
+	hs := make([]crypto.Hash, len(hashes))
+	manifests = make([]*Manifest, len(hashes))
+	for i, hash := range hashes {
+		hs[i] = hash.Hash
+		manifests[i] = &Manifest{
+			Hash: hash,
+			Filename: filepath.Join(root, hash.Filename()),
+			Root: root,
+			Entries: make(Entries, len(entries)),
 		}
-		f, err = os.Create(checksumFile)
+	}
+
+	opts.Progress.measure(root, entries)
+	errs := make([]error, len(entries))
+	entries.Parallel(opts.Jobs, func(i int, entry *Entry) {
+		defer opts.Progress.doneFile()
+		sums, err := entry.calculateAll(root, hs, opts.Progress)
 		if err != nil {
-			die(err)
+			errs[i] = err
+			return
+		}
+		for j, m := range manifests {
+			m.Entries[i] = &Entry{
+				Checksum: formatChecksum(hs[j], sums[j]),
+				Filename: entry.Filename,
+				Hash: hs[j],
+			}
 		}
+	})
+	var failures Failures
+	for _, err := range errs {
+		if err == nil {
+			continue
+		} else if !opts.KeepGoing {
+			return nil, err
+		}
+		failures = append(failures, err)
 	}
-
-	w := NewWriter(f)
-
-	entries, err := EntriesFromPath(cwd)
-	if err != nil {
-		die(err)
+	if failures == nil {
+		return manifests, nil
 	}
 
-	for _, entry := range entries {
-		if err := entry.Fill(hash.Hash); err != nil {
-			die(err)
+	for _, m := range manifests {
+		kept := m.Entries[:0]
+		for _, entry := range m.Entries {
+			if entry != nil {
+				kept = append(kept, entry)
+			}
 		}
+		m.Entries = kept
 	}
-
-	for _, entry := range entries {
-		w.WriteEntry(entry)
-	}
-
-	os.Exit(0)
+	return manifests, failures
 }
-
@@ -0,0 +1,3 @@
+module github.com/kourge/hv
+
+go 1.13
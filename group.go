@@ -0,0 +1,98 @@
+package hv
+
+import (
+	"os"
+	"sort"
+	"container/list"
+)
+
+// Group a list of strings representing files relative to root by their
+// stat()ed file sizes, following symbolic links just as LazyFile.Equal does.
+// The return value is a map, where the key is a file size and the value is a
+// list.List of *LazyFile. For any original file that could not be stat()ed, the
+// returned error is added to the list.List corresponding to the invalid size of
+// -1.
+func GroupBySize(root string, entries *list.List) (groups map[int64]*list.List) {
+	groups = make(map[int64]*list.List)
+	for e := entries.Front(); e != nil; e = e.Next() {
+		var size int64 = -1
+		filename := e.Value.(string)
+		path := FilePath(root, filename)
+
+		info, err := os.Stat(path)
+		if err == nil {
+			size = info.Size()
+		}
+
+		group, exists := groups[size]
+		if !exists {
+			group = list.New()
+			groups[size] = group
+		}
+
+		if size != -1 {
+			group.PushBack(&LazyFile{FileInfo: info, Path: path, Filename: filename})
+		} else {
+			group.PushBack(err)
+		}
+	}
+	return
+}
+
+// The sizes of groups as returned by GroupBySize, in ascending order.
+func sortedSizes(groups map[int64]*list.List) []int64 {
+	sizes := make([]int64, 0, len(groups))
+	for size := range groups {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	return sizes
+}
+
+// Segment a list of *LazyFile by their content treated as a byte array. Returns
+// an array of pointers to a Bucket, each of which contain an array of pointers
+// to a LazyFile. All LazyFiles within the same bucket are byte-by-byte
+// identical.
+func GroupByContent(entries *list.List) (buckets Buckets, errs []error) {
+	if entries.Len() == 0 {
+		return nil, nil
+	}
+
+	b := &LazyFileBucketer{}
+	for e := entries.Front(); e != nil; e = e.Next() {
+		file := e.Value.(*LazyFile)
+		if err := b.Add(file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return b.Buckets, errs
+}
+
+// Segment a list of strings representing files relative to root into buckets
+// of byte-by-byte identical files, first by size and then by content. Files
+// that could not be read are left out, and their errors are returned instead.
+// A single bucket and no errors means that all files are identical.
+func GroupIdentical(root string, files *list.List) (buckets Buckets, errs []error) {
+	groups := GroupBySize(root, files)
+	if group, exists := groups[-1]; exists {
+		for e := group.Front(); e != nil; e = e.Next() {
+			errs = append(errs, e.Value.(error))
+		}
+		delete(groups, -1)
+	}
+
+	for _, size := range sortedSizes(groups) {
+		b, e := GroupByContent(groups[size])
+		buckets, errs = append(buckets, b...), append(errs, e...)
+	}
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i].Files[0].Filename < buckets[j].Files[0].Filename
+	})
+	for _, bucket := range buckets {
+		for _, file := range bucket.Files {
+			file.Close()
+		}
+	}
+	return
+}
@@ -1,4 +1,4 @@
-package main
+package hv
 
 import (
 	"strings"
@@ -6,10 +6,12 @@ import (
 	"crypto"
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/sha512"
 )
 var _ = md5.New
 var _ = sha1.New
+var _ = sha256.New
 var _ = sha512.New
 
 type HashValue struct {
@@ -35,6 +37,9 @@ func (h *HashValue) Set(s string) (err error) {
 	switch strings.ToUpper(s) {
 	case "MD5": h.Hash = crypto.MD5
 	case "SHA1": h.Hash = crypto.SHA1
+	case "SHA224": h.Hash = crypto.SHA224
+	case "SHA256": h.Hash = crypto.SHA256
+	case "SHA384": h.Hash = crypto.SHA384
 	case "SHA512": h.Hash = crypto.SHA512
 	default: err = HashUnavailableError{h.Hash}
 	}
@@ -46,7 +51,43 @@ func (h *HashValue) Filename() string {
 }
 
 func (h *HashValue) Values() []string {
-	return []string{"MD5", "SHA1", "SHA512"}
+	return []string{"MD5", "SHA1", "SHA224", "SHA256", "SHA384", "SHA512"}
+}
+
+// A list of hash functions, given as a comma-separated list of names, e.g.
+// "SHA256,SHA512".
+type HashValues []HashValue
+
+func (hs *HashValues) String() string {
+	names := make([]string, len(*hs))
+	for i := range *hs {
+		names[i] = (*hs)[i].String()
+	}
+	return strings.Join(names, ",")
+}
+
+func (hs *HashValues) Set(s string) error {
+	*hs = nil
+	for _, name := range strings.Split(s, ",") {
+		var h HashValue
+		if err := h.Set(strings.TrimSpace(name)); err != nil {
+			return err
+		}
+		*hs = append(*hs, h)
+	}
+	return nil
+}
+
+// Find the supported hash function whose checksums have the given number of
+// hexadecimal digits. Every supported hash function has a distinct length.
+func HashForDigits(digits int) (h HashValue, ok bool) {
+	for _, name := range h.Values() {
+		h.Set(name)
+		if h.Size() * 2 == digits {
+			return h, true
+		}
+	}
+	return HashValue{}, false
 }
 
 type HashUnavailableError struct {
@@ -0,0 +1,155 @@
+package hv
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"bufio"
+	"strings"
+	"encoding/json"
+	"path/filepath"
+)
+
+// The name of the journal that dedup keeps in a Trash directory.
+const JournalFilename = ".hvjournal"
+
+// Something that was done to a duplicate, as recorded in a journal. Paths are
+// absolute, so that the journal can be replayed from anywhere.
+type Action struct {
+	// What was done: "remove", "link" or "trash".
+	Op string `json:"op"`
+	// The duplicate.
+	Path string `json:"path"`
+	// The file that was kept in place of the duplicate.
+	Target string `json:"target,omitempty"`
+	// Where the duplicate was moved to, if it was trashed.
+	Trash string `json:"trash,omitempty"`
+	// The type of link that was put in place of the duplicate, if any.
+	Link string `json:"link,omitempty"`
+	// The checksum file that the duplicate was dropped from, if any, and its
+	// entry there as a line of that file, so that it can be listed again once
+	// the duplicate is put back.
+	Manifest string `json:"manifest,omitempty"`
+	Entry string `json:"entry,omitempty"`
+}
+
+// Note that entry was dropped from the checksum file at the absolute path
+// filename along with the duplicate. Entries that name their own hash function
+// are kept in the BSD or tagged format.
+func (a *Action) Dropped(filename string, entry *Entry) {
+	a.Manifest = filename
+	if entry.Hash != 0x0 {
+		a.Entry = entry.TaggedString()
+	} else {
+		a.Entry = entry.String()
+	}
+}
+
+// The entry that the duplicate was dropped from a checksum file with, if any.
+func (a *Action) DroppedEntry() (*Entry, error) {
+	if a.Entry == "" {
+		return nil, nil
+	}
+	return NewReader(strings.NewReader(a.Entry)).ReadEntry()
+}
+
+func (a *Action) Undoable() bool {
+	return a.Op == "trash"
+}
+
+// Put the duplicate back where it was. Only trashed files can be put back, and
+// only if nothing but the link that replaced them, if any, is in their place.
+func (a *Action) Undo() error {
+	if !a.Undoable() {
+		return fmt.Errorf("%s cannot be restored, since it was not trashed", a.Path)
+	}
+
+	switch a.Link {
+	case "":
+		if _, err := os.Lstat(a.Path); err == nil {
+			return &os.PathError{Op: "restore", Path: a.Path, Err: os.ErrExist}
+		}
+		if err := os.MkdirAll(filepath.Dir(a.Path), 0755); err != nil {
+			return err
+		}
+	case "sym":
+		if info, err := os.Lstat(a.Path); err != nil {
+			return err
+		} else if info.Mode() & os.ModeSymlink == 0 {
+			return fmt.Errorf("%s is no longer a symbolic link", a.Path)
+		}
+	case "hard":
+		if same, err := SameFile(a.Target, a.Path); err != nil {
+			return err
+		} else if !same {
+			return fmt.Errorf("%s is no longer a link to %s", a.Path, a.Target)
+		}
+	}
+	return moveFile(a.Trash, a.Path)
+}
+
+// A journal that actions are appended to as they happen.
+type Journal struct {
+	file *os.File
+}
+
+// Open the journal at filename for appending, creating it if need be.
+func OpenJournal(filename string) (*Journal, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: file}, nil
+}
+
+// Append a, and make sure it is on disk before returning.
+func (j *Journal) Record(a Action) error {
+	if err := writeAction(j.file, a); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+func writeAction(w io.Writer, a Action) error {
+	line, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// Read every action in the journal at filename, oldest first.
+func ReadJournal(filename string) (actions []Action, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		var a Action
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %s", filename, n, err)
+		}
+		actions = append(actions, a)
+	}
+	return actions, scanner.Err()
+}
+
+// Replace the journal at filename with actions, atomically.
+func WriteJournal(filename string, actions []Action) error {
+	return writeFileAtomically(filename, func(w io.Writer) error {
+		for _, a := range actions {
+			if err := writeAction(w, a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,113 @@
+package hv
+
+import (
+	"os"
+	"fmt"
+	"errors"
+	"regexp"
+	"strings"
+	"container/list"
+)
+
+const regexPolicyPrefix = "regex:"
+
+// A policy that decides which file among a set of duplicates to keep, so that
+// dedup can run without prompting.
+type KeepPolicy struct {
+	Name string
+	Pattern *regexp.Regexp
+}
+
+func (p *KeepPolicy) String() string {
+	if p.Pattern != nil {
+		return regexPolicyPrefix + p.Pattern.String()
+	}
+	return p.Name
+}
+
+func (p *KeepPolicy) Set(s string) (err error) {
+	if strings.HasPrefix(s, regexPolicyPrefix) {
+		pattern, err := regexp.Compile(s[len(regexPolicyPrefix):])
+		if err != nil {
+			return err
+		}
+		p.Name, p.Pattern = "regex", pattern
+		return nil
+	}
+
+	switch s {
+	case "oldest", "newest", "shortest-path", "longest-path", "alphabetical-first":
+		p.Name, p.Pattern = s, nil
+	default:
+		err = fmt.Errorf("%s is not a known keep policy", s)
+	}
+	return
+}
+
+func (p *KeepPolicy) Values() []string {
+	return []string{"oldest", "newest", "shortest-path", "longest-path", "alphabetical-first", regexPolicyPrefix + "PATTERN"}
+}
+
+func (p *KeepPolicy) IsSet() bool {
+	return p.Name != ""
+}
+
+// Pick the file to keep among duplicates, which is a list.List of filenames
+// relative to root. The choice is 1-based, in the same way as an answer to the
+// interactive prompt. Ties are broken in favor of the file that comes first.
+func (p *KeepPolicy) Choose(root string, duplicates *list.List) (choice int, err error) {
+	files := make([]string, 0, duplicates.Len())
+	for e := duplicates.Front(); e != nil; e = e.Next() {
+		files = append(files, e.Value.(string))
+	}
+
+	switch p.Name {
+	case "oldest", "newest":
+		return chooseByModTime(root, files, p.Name == "newest")
+	case "shortest-path":
+		return chooseBest(files, func(a, b string) bool { return len(a) < len(b) }), nil
+	case "longest-path":
+		return chooseBest(files, func(a, b string) bool { return len(a) > len(b) }), nil
+	case "alphabetical-first":
+		return chooseBest(files, func(a, b string) bool { return a < b }), nil
+	case "regex":
+		for i, file := range files {
+			if p.Pattern.MatchString(file) {
+				return i + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("no file matches %s", p.Pattern)
+	default:
+		return 0, errors.New("no keep policy given")
+	}
+}
+
+// Return the 1-based index of the file for which better returns true when
+// compared with every other file.
+func chooseBest(files []string, better func(a, b string) bool) (choice int) {
+	best := 0
+	for i := 1; i < len(files); i++ {
+		if better(files[i], files[best]) {
+			best = i
+		}
+	}
+	return best + 1
+}
+
+func chooseByModTime(root string, files []string, newest bool) (choice int, err error) {
+	best := -1
+	var bestInfo os.FileInfo
+	for i, file := range files {
+		info, err := os.Stat(FilePath(root, file))
+		if err != nil {
+			return 0, err
+		}
+
+		if best == -1 ||
+			(newest && info.ModTime().After(bestInfo.ModTime())) ||
+			(!newest && info.ModTime().Before(bestInfo.ModTime())) {
+			best, bestInfo = i, info
+		}
+	}
+	return best + 1, nil
+}
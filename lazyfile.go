@@ -1,7 +1,9 @@
-package main
+package hv
 
 import (
 	"os"
+	"io"
+	"math"
 	"bytes"
 	"fmt"
 )
@@ -10,19 +12,29 @@ const CHUNK_SIZE int64 = 4096
 
 type LazyFile struct {
 	os.FileInfo
+	// The path used to open the file. If empty, the FileInfo's name is used.
+	Path string
+	// The file's slash-separated name as listed in a checksum file, if any.
+	Filename string
 	file *os.File
-	data []byte
 }
 
 func (fi *LazyFile) String() string {
-	return fmt.Sprintf("{\"%s\", %d}", fi.FileInfo.Name(), len(fi.data))
+	return fmt.Sprintf("{\"%s\", %d}", fi.FileInfo.Name(), fi.Size())
+}
+
+func (fi *LazyFile) path() string {
+	if fi.Path == "" {
+		return fi.Name()
+	}
+	return fi.Path
 }
 
 func (fi *LazyFile) Open() (err error) {
 	if fi.file != nil {
 		return
 	}
-	file, err := os.Open(fi.Name())
+	file, err := os.Open(fi.path())
 	if err == nil {
 		fi.file = file
 	}
@@ -33,49 +45,54 @@ func (fi *LazyFile) Close() (err error) {
 	if fi.file == nil {
 		return nil
 	}
-	return fi.file.Close()
-}
-
-func (fi *LazyFile) Slurp() (n int, err error) {
-	if err := fi.Open(); err != nil {
-		return 0, err
-	}
-	buffer := make([]byte, CHUNK_SIZE)
-	n, err = fi.file.Read(buffer)
-	if err == nil {
-		fi.data = append(fi.data, buffer...)
-	}
+	err = fi.file.Close()
+	fi.file = nil
 	return
 }
 
+// Whether fi and other hold the same bytes. Both are read from the start to
+// their end, one chunk at a time, and nothing is kept once a chunk is compared,
+// so that files of any size can be compared with as many others as needed. The
+// sizes they were found with only serve to tell them apart quickly.
 func (fi *LazyFile) Equal(other *LazyFile) (equal bool, err error) {
 	// Check both files' length first
 	if fi.Size() != other.Size() {
 		return false, nil
 	}
-	size := fi.Size()
+	if err := fi.Open(); err != nil {
+		return false, err
+	}
+	if err := other.Open(); err != nil {
+		return false, err
+	}
 
-	var i int64 = 0
-	for i < size {
-		// Slurp when necessary
-		if i + CHUNK_SIZE > int64(len(fi.data)) {
-			if _, err := fi.Slurp(); err != nil {
-				return false, err
-			}
+	x, y := io.NewSectionReader(fi.file, 0, math.MaxInt64), io.NewSectionReader(other.file, 0, math.MaxInt64)
+	a, b := make([]byte, CHUNK_SIZE), make([]byte, CHUNK_SIZE)
+	for {
+		n, err := readChunk(x, a)
+		if err != nil {
+			return false, err
 		}
-		if i + CHUNK_SIZE > int64(len(other.data)) {
-			if _, err := other.Slurp(); err != nil {
-				return false, err
-			}
+		m, err := readChunk(y, b)
+		if err != nil {
+			return false, err
 		}
 
-		x, y := fi.data[i:i+CHUNK_SIZE], other.data[i:i+CHUNK_SIZE]
-		if !bytes.Equal(x, y) {
+		if n != m || !bytes.Equal(a[:n], b[:m]) {
 			return false, nil
 		}
-		i += CHUNK_SIZE
+		if n < len(a) {
+			return true, nil
+		}
 	}
-
-	return true, nil
 }
 
+// Fill chunk from r, and return how much of it was filled, which is less than
+// all of it only at the end of r.
+func readChunk(r io.Reader, chunk []byte) (n int, err error) {
+	n, err = io.ReadFull(r, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return
+}
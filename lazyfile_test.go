@@ -0,0 +1,104 @@
+package hv
+
+import (
+	"os"
+	"bytes"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func lazyFile(t *testing.T, path string) *LazyFile {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &LazyFile{FileInfo: info, Path: path}
+}
+
+func TestLazyFileEqual(t *testing.T) {
+	chunk := int(CHUNK_SIZE)
+	data := func(n int) []byte {
+		return bytes.Repeat([]byte("0123456789abcdef"), n / 16 + 1)[:n]
+	}
+	flip := func(b []byte, i int) []byte {
+		c := append([]byte(nil), b...)
+		c[i] ^= 0xff
+		return c
+	}
+
+	tests := []struct {
+		name string
+		a, b []byte
+		equal bool
+	}{
+		{"empty", nil, nil, true},
+		{"one byte", data(1), data(1), true},
+		{"one chunk", data(chunk), data(chunk), true},
+		{"chunk and a byte", data(chunk + 1), data(chunk + 1), true},
+		{"several chunks", data(3 * chunk), data(3 * chunk), true},
+		{"first byte differs", data(3 * chunk), flip(data(3 * chunk), 0), false},
+		{"last byte differs", data(3 * chunk + 7), flip(data(3 * chunk + 7), 3 * chunk + 6), false},
+		{"last byte of a chunk differs", data(2 * chunk), flip(data(2 * chunk), chunk - 1), false},
+		{"sizes differ", data(chunk), data(chunk + 1), false},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "hv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		writeFiles(t, dir, map[string][]byte{"a": test.a, "b": test.b})
+
+		a, b := lazyFile(t, filepath.Join(dir, "a")), lazyFile(t, filepath.Join(dir, "b"))
+		// Compare twice, since a file is compared with every other file in a group.
+		for i := 0; i < 2; i++ {
+			if equal, err := a.Equal(b); err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			} else if equal != test.equal {
+				t.Errorf("%s: Equal() = %v, want %v", test.name, equal, test.equal)
+			}
+		}
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestLazyFileEqualFollowsSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The link is as long as b, but what it points to is longer and only starts
+	// out the same.
+	writeFiles(t, dir, map[string][]byte{"target": []byte("target and more"), "b": []byte("target")})
+	if err := os.Symlink("target", filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	link, b := lazyFile(t, filepath.Join(dir, "link")), lazyFile(t, filepath.Join(dir, "b"))
+	defer link.Close()
+	defer b.Close()
+	if equal, err := link.Equal(b); err != nil {
+		t.Fatal(err)
+	} else if equal {
+		t.Errorf("a link to a longer file is equal to a prefix of it")
+	}
+}
@@ -0,0 +1,113 @@
+package hv
+
+import (
+	"os"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+)
+
+// How dedup disposes of duplicates: by deleting them, or by replacing them with
+// a hard or symbolic link to the file that is kept.
+type LinkMode struct {
+	Name string
+}
+
+func (m *LinkMode) String() string {
+	return m.Name
+}
+
+func (m *LinkMode) Set(s string) (err error) {
+	switch s {
+	case "hard", "sym":
+		m.Name = s
+	default:
+		err = fmt.Errorf("%s is not a known link type", s)
+	}
+	return
+}
+
+func (m *LinkMode) Values() []string {
+	return []string{"hard", "sym"}
+}
+
+func (m *LinkMode) IsSet() bool {
+	return m.Name != ""
+}
+
+// The shell command equivalent to replacing file with a link to target.
+func (m *LinkMode) Command(target, file string) string {
+	if m.Name == "sym" {
+		return fmt.Sprintf("ln -sf %s %s", m.Target(target, file), file)
+	}
+	return fmt.Sprintf("ln -f %s %s", target, file)
+}
+
+// What a link at file to target is made from: target itself for a hard link,
+// or the relative path that a symbolic link at file points to.
+func (m *LinkMode) Target(target, file string) string {
+	if m.Name == "sym" {
+		return symlinkTarget(target, file)
+	}
+	return target
+}
+
+// Replace file with a link to target. The link is first created under a
+// temporary name in the same directory as file and then renamed over it, so
+// file is never missing, even if this fails part way through.
+func (m *LinkMode) Replace(target, file string) error {
+	if m.Name == "hard" {
+		if same, err := SameFile(target, file); err != nil {
+			return err
+		} else if same {
+			return nil
+		}
+	}
+
+	dir, base := filepath.Split(file)
+	for tries := 0; ; tries++ {
+		temp := filepath.Join(dir, fmt.Sprintf(".%s.%d.hvlink", base, rand.Int31()))
+
+		var err error
+		if m.Name == "sym" {
+			err = os.Symlink(symlinkTarget(target, file), temp)
+		} else {
+			err = os.Link(target, temp)
+		}
+		if os.IsExist(err) && tries < 10 {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := os.Rename(temp, file); err != nil {
+			os.Remove(temp)
+			return err
+		}
+		return nil
+	}
+}
+
+// The path that a symbolic link at file should point to in order to reach
+// target, relative to the directory of file so that the tree can be moved.
+func symlinkTarget(target, file string) string {
+	rel, err := filepath.Rel(filepath.Dir(file), target)
+	if err != nil {
+		return target
+	}
+	return rel
+}
+
+// Whether the paths a and b lead to the same file, e.g. because one is a hard
+// or symbolic link to the other.
+func SameFile(a, b string) (same bool, err error) {
+	x, err := os.Stat(a)
+	if err != nil {
+		return
+	}
+	y, err := os.Stat(b)
+	if err != nil {
+		return
+	}
+	return os.SameFile(x, y), nil
+}
@@ -0,0 +1,208 @@
+// Package hv reads, writes, generates and verifies checksum files in the format
+// used by GNU coreutils' md5sum, sha1sum and friends, and finds duplicate files
+// with their help.
+package hv
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"errors"
+	"path/filepath"
+)
+
+// The hash functions whose checksum files OpenManifest looks for, in order,
+// when no hash function is given.
+var PreferredHashes = []string{"SHA512", "SHA384", "SHA256", "SHA224", "SHA1", "MD5"}
+
+var ErrNoManifest = errors.New("No known checksum files found in directory")
+
+// A checksum file and the entries in it.
+type Manifest struct {
+	// The hash function of the checksum file. Entries that name their own hash
+	// function use that one instead.
+	Hash HashValue
+	// The path of the checksum file.
+	Filename string
+	// The directory that the filenames of the entries are relative to.
+	Root string
+	Entries Entries
+	// The malformed lines that were skipped when the checksum file was read.
+	Malformed []*ParseError
+}
+
+// Options that control how a checksum file is read.
+type ReadOptions struct {
+	// Whether to fail on the first malformed line instead of skipping it.
+	Strict bool
+}
+
+// Options that control how a checksum file is written.
+type WriteOptions struct {
+	// Whether to write entries in the BSD or tagged format.
+	Tagged bool
+}
+
+// The path of the file named filename in a checksum file whose filenames are
+// relative to root.
+func FilePath(root, filename string) string {
+	return filepath.Join(root, filepath.FromSlash(filename))
+}
+
+// Read the checksum file for hash in the directory root. If hash is unset, the
+// checksum files for PreferredHashes are tried in order, and ErrNoManifest is
+// returned if there are none.
+func OpenManifest(root string, hash HashValue, opts ReadOptions) (m *Manifest, err error) {
+	if hash.Hash != 0x0 {
+		m = &Manifest{Hash: hash, Root: root, Filename: filepath.Join(root, hash.Filename())}
+		return m, m.Load(opts)
+	}
+
+	for _, tryHash := range PreferredHashes {
+		h := HashValue{}
+		h.Set(tryHash)
+		m = &Manifest{Hash: h, Root: root, Filename: filepath.Join(root, h.Filename())}
+		if err = m.Load(opts); !os.IsNotExist(err) {
+			return m, err
+		}
+	}
+	return nil, ErrNoManifest
+}
+
+// Read the checksum file named filename, whose filenames are relative to root.
+// If hash is unset, it is inferred from the lengths of the checksums.
+func OpenManifestFile(filename, root string, hash HashValue, opts ReadOptions) (m *Manifest, err error) {
+	m = &Manifest{Hash: hash, Root: root, Filename: filename}
+	return m, m.Load(opts)
+}
+
+// Read m.Filename into m.
+func (m *Manifest) Load(opts ReadOptions) (err error) {
+	file, err := os.Open(m.Filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if err = m.Read(file, opts); err != nil {
+		err = fmt.Errorf("%s: %w", m.Filename, err)
+	}
+	return
+}
+
+// Read every entry from r into m. Malformed lines are skipped and kept in
+// m.Malformed, unless opts.Strict is set, in which case the first one is
+// returned as a *ParseError. If m.Hash is unset, it is inferred from the length
+// of the first checksum that is not tagged with its own hash function, and
+// every later checksum that is not tagged has to be as long. If every checksum
+// is tagged, m.Hash is that of the first one, for files that are added later.
+func (m *Manifest) Read(r io.Reader, opts ReadOptions) error {
+	m.Entries = make(Entries, 0)
+	reader := NewReader(r)
+	reader.Hash, reader.Strict = m.Hash.Hash, opts.Strict
+	var unknown error
+	err := reader.Each(func(entry *Entry) {
+		if m.Hash.Hash == 0x0 && entry.Hash == 0x0 && unknown == nil {
+			// The reader validates every later line against the inferred hash.
+			if hash, ok := HashForDigits(len(entry.Checksum)); ok {
+				m.Hash, reader.Hash = hash, hash.Hash
+			} else {
+				unknown = fmt.Errorf("cannot tell the hash function of a checksum with %d digits", len(entry.Checksum))
+			}
+		}
+		m.Entries = append(m.Entries, entry)
+	})
+	m.Malformed = reader.Malformed
+	if err != nil {
+		return err
+	}
+	if m.Hash.Hash == 0x0 && unknown == nil && len(m.Entries) > 0 {
+		m.Hash.Hash = m.Entries[0].Hash
+	}
+	return unknown
+}
+
+// Write every entry of m to w. In the tagged format, entries that do not name
+// their own hash function are written with m's.
+func (m *Manifest) Write(w io.Writer, opts WriteOptions) error {
+	writer := NewWriter(w)
+	writer.Tagged = opts.Tagged
+	for _, entry := range m.Entries {
+		if opts.Tagged && entry.Hash == 0x0 {
+			copied := *entry
+			copied.Hash = m.Hash.Hash
+			entry = &copied
+		}
+		if _, err := writer.WriteEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Whether any entry of m was read from a line in the BSD or tagged format, in
+// which case m is best written back in that format.
+func (m *Manifest) Tagged() bool {
+	for _, entry := range m.Entries {
+		if entry.Hash != 0x0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Leave out the entries of m for the given filenames.
+func (m *Manifest) Drop(filenames []string) {
+	dropped := make(map[string]bool)
+	for _, filename := range filenames {
+		dropped[filename] = true
+	}
+
+	kept := m.Entries[:0]
+	for _, entry := range m.Entries {
+		if !dropped[entry.Filename] {
+			kept = append(kept, entry)
+		}
+	}
+	m.Entries = kept
+}
+
+// Add entry to m in filename order, i.e. before the first entry whose filename
+// sorts after its own, so that a checksum file in filename order stays that
+// way, unless m already has an entry for its filename. Returns whether it was
+// added.
+func (m *Manifest) Add(entry *Entry) bool {
+	at := len(m.Entries)
+	for i, e := range m.Entries {
+		if e.Filename == entry.Filename {
+			return false
+		}
+		if e.Filename > entry.Filename && i < at {
+			at = i
+		}
+	}
+	m.Entries = append(m.Entries, nil)
+	copy(m.Entries[at+1:], m.Entries[at:])
+	m.Entries[at] = entry
+	return true
+}
+
+// Write m to m.Filename, replacing the file atomically.
+func (m *Manifest) Save(opts WriteOptions) error {
+	return writeFileAtomically(m.Filename, func(w io.Writer) error {
+		return m.Write(w, opts)
+	})
+}
+
+// The path of the file of entry.
+func (m *Manifest) Path(entry *Entry) string {
+	return entry.Path(m.Root)
+}
+
+// A copy of opts that also leaves out the checksum file itself.
+func (m *Manifest) ignoringSelf(opts WalkOptions) WalkOptions {
+	ignore := make([]string, len(opts.Ignore), len(opts.Ignore) + 1)
+	copy(ignore, opts.Ignore)
+	opts.Ignore = append(ignore, m.Filename)
+	return opts
+}
@@ -0,0 +1,69 @@
+package hv
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// An entry of merged manifests, and the manifest it came from.
+type Origin struct {
+	Manifest *Manifest
+	Entry *Entry
+}
+
+// Combine the entries of several manifests into one list, in which every entry
+// is named by the absolute, slash-separated path of its file, i.e. its filename
+// joined to the root of its manifest once symbolic links in the root are
+// resolved, so that the same filename under different roots stays apart. A file
+// that is listed more than once, e.g. because one root lies inside another or
+// is another's symbolic link, or because it is a link to a file listed before,
+// is only kept the first time. The origin of every entry is returned under its
+// new name.
+func Merge(manifests []*Manifest) (entries Entries, origins map[string]Origin) {
+	origins = make(map[string]Origin)
+	seen := make(map[int64][]os.FileInfo)
+	for _, m := range manifests {
+		root := canonicalPath(m.Root)
+		for _, entry := range m.Entries {
+			path := FilePath(root, entry.Filename)
+			name := filepath.ToSlash(path)
+			if _, exists := origins[name]; exists {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil {
+				if seenFile(seen[info.Size()], info) {
+					continue
+				}
+				seen[info.Size()] = append(seen[info.Size()], info)
+			}
+			origins[name] = Origin{Manifest: m, Entry: entry}
+
+			merged := *entry
+			merged.Filename = name
+			entries = append(entries, &merged)
+		}
+	}
+	return
+}
+
+// Whether info is the same file as any of infos.
+func seenFile(infos []os.FileInfo, info os.FileInfo) bool {
+	for _, seen := range infos {
+		if os.SameFile(seen, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// The absolute form of path with every symbolic link in it resolved, or as much
+// of that as can be worked out.
+func canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
@@ -0,0 +1,60 @@
+package hv
+
+import (
+	"os"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestMergeTakesEveryFileOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string][]byte{"photos/x.jpg": []byte("x"), "photos/y.jpg": []byte("y")})
+	photos := filepath.Join(dir, "photos")
+	if err := os.Symlink(photos, filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Link(filepath.Join(photos, "x.jpg"), filepath.Join(photos, "hard.jpg")); err != nil {
+		t.Skip(err)
+	}
+
+	entries := func(filenames ...string) Entries {
+		e := make(Entries, len(filenames))
+		for i, filename := range filenames {
+			e[i] = &Entry{Checksum: "0123", Filename: filename}
+		}
+		return e
+	}
+	manifests := []*Manifest{
+		{Root: photos, Entries: entries("x.jpg", "y.jpg")},
+		{Root: filepath.Join(dir, "link"), Entries: entries("x.jpg", "y.jpg", "hard.jpg")},
+		{Root: filepath.Join(photos, "..", "photos"), Entries: entries("y.jpg", "missing.jpg")},
+	}
+
+	merged, origins := Merge(manifests)
+	var names []string
+	for _, entry := range merged {
+		names = append(names, entry.Filename)
+	}
+	root := canonicalPath(photos)
+	want := []string{
+		filepath.ToSlash(filepath.Join(root, "x.jpg")),
+		filepath.ToSlash(filepath.Join(root, "y.jpg")),
+		filepath.ToSlash(filepath.Join(root, "missing.jpg")),
+	}
+	if len(names) != len(want) {
+		t.Fatalf("Merge() = %q, want %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Merge()[%d] = %q, want %q", i, names[i], want[i])
+		}
+	}
+	if origin := origins[want[2]]; origin.Manifest != manifests[2] || origin.Entry.Filename != "missing.jpg" {
+		t.Errorf("origin of %s = %v", want[2], origin)
+	}
+}
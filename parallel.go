@@ -0,0 +1,44 @@
+package hv
+
+import (
+	"sync"
+)
+
+// Call f once for every entry, using at most jobs goroutines at a time. The
+// index of each entry is passed along so that results can be stored by
+// position, which keeps them in the same order as the entries regardless of
+// the order in which the work finishes. Returns once every call has returned.
+func (entries Entries) Parallel(jobs int, f func(i int, entry *Entry)) {
+	parallel(len(entries), jobs, func(i int) {
+		f(i, entries[i])
+	})
+}
+
+// Call f once for every index from 0 to n - 1, using at most jobs goroutines at
+// a time. Returns once every call has returned.
+func parallel(n, jobs int, f func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > n {
+		jobs = n
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	for j := 0; j < jobs; j++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				f(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
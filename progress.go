@@ -0,0 +1,88 @@
+package hv
+
+import (
+	"os"
+	"time"
+	"sync/atomic"
+)
+
+// Counts the files and bytes hashed so far by a long-running operation, such as
+// Generate or Manifest.Verify, so that another goroutine can report on it. Its
+// methods are safe for concurrent use.
+type Progress struct {
+	files int64
+	bytes int64
+	totalFiles int64
+	totalBytes int64
+	// When the operation started.
+	Started time.Time
+}
+
+func (p *Progress) Files() int64 { return atomic.LoadInt64(&p.files) }
+func (p *Progress) Bytes() int64 { return atomic.LoadInt64(&p.bytes) }
+func (p *Progress) TotalFiles() int64 { return atomic.LoadInt64(&p.totalFiles) }
+func (p *Progress) TotalBytes() int64 { return atomic.LoadInt64(&p.totalBytes) }
+
+// The time since the operation started.
+func (p *Progress) Elapsed() time.Duration {
+	return time.Since(p.Started)
+}
+
+// The average number of bytes hashed per second so far.
+func (p *Progress) Rate() float64 {
+	seconds := p.Elapsed().Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(p.Bytes()) / seconds
+}
+
+// The estimated time until all bytes are hashed at the current rate, or false
+// if there is no estimate yet.
+func (p *Progress) Remaining() (remaining time.Duration, ok bool) {
+	rate := p.Rate()
+	if rate <= 0 {
+		return 0, false
+	}
+	left := p.TotalBytes() - p.Bytes()
+	if left < 0 {
+		left = 0
+	}
+	return time.Duration(float64(left) / rate * float64(time.Second)), true
+}
+
+// Add the files of entries, and their sizes as stat()ed, to the totals. Files
+// that cannot be stat()ed only count towards the number of files.
+func (p *Progress) measure(root string, entries Entries) {
+	if p == nil {
+		return
+	}
+	if p.Started.IsZero() {
+		p.Started = time.Now()
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if info, err := os.Stat(entry.Path(root)); err == nil {
+			size += info.Size()
+		}
+	}
+	atomic.AddInt64(&p.totalFiles, int64(len(entries)))
+	atomic.AddInt64(&p.totalBytes, size)
+}
+
+func (p *Progress) doneFile() {
+	if p != nil {
+		atomic.AddInt64(&p.files, 1)
+	}
+}
+
+// Counts the bytes written to it towards a Progress.
+type progressWriter struct {
+	*Progress
+}
+
+func (w progressWriter) Write(b []byte) (n int, err error) {
+	atomic.AddInt64(&w.bytes, int64(len(b)))
+	return len(b), nil
+}
@@ -1,4 +1,4 @@
-package main
+package hv
 
 import (
 	"os"
@@ -6,42 +6,179 @@ import (
 	"io"
 	"strings"
 	"bufio"
+	"crypto"
 )
 var _ = fmt.Println
 
-const Separator = "  "
+// Separates the checksum from the filename in the GNU format, which is either a
+// Separator for text mode or a BinarySeparator for binary mode.
+const (
+	Separator = "  "
+	BinarySeparator = " *"
+)
+
+// Starts a line whose filename has been escaped.
+const EscapeMarker = "\\"
+
+// Separates the filename from the checksum in the BSD or tagged format.
+const TagSeparator = ") = "
 
 type Reader struct {
 	*bufio.Reader
+	// The hash function that checksums are validated against, unless a line
+	// names its own. If unset, checksums are only checked for being hexadecimal.
+	Hash crypto.Hash
+	// Whether Each stops at the first malformed line instead of skipping it.
+	Strict bool
+	// The number of lines read so far.
+	Line int
+	// The malformed lines that Each has skipped.
+	Malformed []*ParseError
 }
 
 func NewReader(r io.Reader) *Reader {
-	return &Reader{bufio.NewReader(r)}
+	return &Reader{Reader: bufio.NewReader(r)}
 }
 
+// A line of a checksum file that could not be parsed.
+type ParseError struct {
+	Line int
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// Read the next entry. If the line it is on is malformed, the returned error is
+// a *ParseError, and reading may continue with the next line.
 func (r *Reader) ReadEntry() (entry *Entry, err error) {
-	bytes, _, err := r.ReadLine()
-	if err != nil {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	} else if err != nil {
+		return
+	}
+	r.Line++
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+	reason := ""
+	defer func() {
+		if reason != "" {
+			entry, err = nil, &ParseError{Line: r.Line, Reason: reason}
+		}
+	}()
+
+	if line == "" {
+		reason = "empty line"
 		return
 	}
 
-	line := string(bytes)
-	sep := strings.Index(line, Separator)
-	if sep == -1 {
+	escaped := strings.HasPrefix(line, EscapeMarker)
+	if escaped {
+		line = line[len(EscapeMarker):]
+	}
+
+	if entry, reason = parseTaggedLine(line); entry == nil && reason == "" {
+		entry, reason = parseLine(line)
+	}
+	if reason != "" {
 		return
 	}
 
-	entry = &Entry{Checksum: line[0:sep], Filename: line[sep+len(Separator):]}
+	if escaped {
+		filename, ok := unescapeFilename(entry.Filename)
+		if !ok {
+			reason = "invalid escape sequence in filename"
+			return
+		}
+		entry.Filename = filename
+	}
+
+	reason = validateChecksum(entry.Checksum, entry.HashOr(r.Hash))
 	return
 }
 
+// Parse a line in the GNU format, e.g. "checksum  file" or "checksum *file".
+// Returns the reason if the line is not in that format.
+func parseLine(line string) (entry *Entry, reason string) {
+	sep := strings.Index(line, " ")
+	if sep <= 0 || sep + 2 > len(line) {
+		return nil, "no separator between checksum and filename"
+	}
+
+	entry = &Entry{Checksum: line[:sep], Filename: line[sep+2:]}
+	switch line[sep:sep+2] {
+	case Separator:
+	case BinarySeparator:
+		entry.Binary = true
+	default:
+		return nil, "no separator between checksum and filename"
+	}
+
+	if entry.Filename == "" {
+		return nil, "missing filename"
+	}
+	return
+}
+
+// Parse a line in the BSD or tagged format, e.g. "SHA256 (file) = checksum".
+// Returns nil and no reason if the line is not in that format at all, or the
+// reason if it is but cannot be used.
+func parseTaggedLine(line string) (entry *Entry, reason string) {
+	lparen := strings.Index(line, " (")
+	rparen := strings.LastIndex(line, TagSeparator)
+	if lparen <= 0 || rparen < lparen + 2 {
+		return nil, ""
+	}
+
+	name := line[:lparen]
+	if strings.ContainsAny(name, " \t") {
+		return nil, ""
+	}
+	h := &HashValue{}
+	if err := h.Set(name); err != nil {
+		return nil, fmt.Sprintf("unknown hash function %s", name)
+	}
+
+	entry = &Entry{
+		Checksum: line[rparen+len(TagSeparator):],
+		Filename: line[lparen+2:rparen],
+		Hash: h.Hash,
+	}
+	if entry.Filename == "" {
+		return nil, "missing filename"
+	}
+	return
+}
+
+// Check that checksum is a plausible output of h. Returns the reason if not.
+func validateChecksum(checksum string, h crypto.Hash) (reason string) {
+	if checksum == "" || strings.Trim(checksum, "0123456789abcdefABCDEF") != "" {
+		return fmt.Sprintf("checksum %q is not hexadecimal", checksum)
+	}
+
+	if h == 0x0 {
+		return ""
+	}
+	if digits := h.Size() * 2; len(checksum) != digits {
+		hash := &HashValue{h}
+		return fmt.Sprintf("checksum has %d digits, but %s checksums have %d", len(checksum), hash, digits)
+	}
+	return ""
+}
+
+// Call f with every entry. Malformed lines are collected in r.Malformed and
+// skipped, unless r.Strict is set, in which case the first one is returned.
 func (r *Reader) Each(f func(*Entry)) (err error) {
 	for {
 		if e, err := r.ReadEntry(); err == io.EOF {
 			break
+		} else if perr, ok := err.(*ParseError); ok && !r.Strict {
+			r.Malformed = append(r.Malformed, perr)
 		} else if err != nil {
 			return err
-		} else if e != nil {
+		} else {
 			f(e)
 		}
 	}
@@ -53,6 +190,7 @@ func Load(filename string) (m map[string]string, err error) {
 	if err != nil {
 		return
 	}
+	defer file.Close()
 
 	m = make(map[string]string)
 	r := NewReader(file)
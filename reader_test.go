@@ -0,0 +1,195 @@
+package hv
+
+import (
+	"io"
+	"crypto"
+	"strings"
+	"testing"
+)
+
+const sha1Sum = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		entry *Entry
+	}{
+		{sha1Sum + "  file", &Entry{Checksum: sha1Sum, Filename: "file"}},
+		{sha1Sum + " *file", &Entry{Checksum: sha1Sum, Filename: "file", Binary: true}},
+		{sha1Sum + "  two  spaces", &Entry{Checksum: sha1Sum, Filename: "two  spaces"}},
+		{sha1Sum + "   leading space", &Entry{Checksum: sha1Sum, Filename: " leading space"}},
+		{sha1Sum + "  *star", &Entry{Checksum: sha1Sum, Filename: "*star"}},
+		{sha1Sum + " file", nil},
+		{sha1Sum + "\tfile", nil},
+		{sha1Sum + "  ", nil},
+		{sha1Sum, nil},
+		{"  file", nil},
+	}
+
+	for _, test := range tests {
+		entry, reason := parseLine(test.line)
+		if test.entry == nil {
+			if reason == "" {
+				t.Errorf("parseLine(%q) = %+v, want a reason", test.line, entry)
+			}
+		} else if reason != "" {
+			t.Errorf("parseLine(%q) fails: %s", test.line, reason)
+		} else if *entry != *test.entry {
+			t.Errorf("parseLine(%q) = %+v, want %+v", test.line, entry, test.entry)
+		}
+	}
+}
+
+func TestParseTaggedLine(t *testing.T) {
+	tests := []struct {
+		line string
+		entry *Entry
+		// Whether the line is in the tagged format, even if it cannot be used.
+		tagged bool
+	}{
+		{"SHA1 (file) = " + sha1Sum, &Entry{Checksum: sha1Sum, Filename: "file", Hash: crypto.SHA1}, true},
+		{"MD5 (a (b) = c) = 0123", &Entry{Checksum: "0123", Filename: "a (b) = c", Hash: crypto.MD5}, true},
+		{"SHA256 ( space ) = 0123", &Entry{Checksum: "0123", Filename: " space ", Hash: crypto.SHA256}, true},
+		{"WHIRLPOOL (file) = 0123", nil, true},
+		{"SHA1 () = " + sha1Sum, nil, true},
+		{sha1Sum + "  file (1) = 2", nil, false},
+		{sha1Sum + "  file", nil, false},
+		{"(file) = 0123", nil, false},
+	}
+
+	for _, test := range tests {
+		entry, reason := parseTaggedLine(test.line)
+		switch {
+		case test.entry != nil:
+			if reason != "" {
+				t.Errorf("parseTaggedLine(%q) fails: %s", test.line, reason)
+			} else if entry == nil || *entry != *test.entry {
+				t.Errorf("parseTaggedLine(%q) = %+v, want %+v", test.line, entry, test.entry)
+			}
+		case test.tagged:
+			if entry != nil || reason == "" {
+				t.Errorf("parseTaggedLine(%q) = %+v, %q, want a reason", test.line, entry, reason)
+			}
+		default:
+			if entry != nil || reason != "" {
+				t.Errorf("parseTaggedLine(%q) = %+v, %q, want neither", test.line, entry, reason)
+			}
+		}
+	}
+}
+
+func TestUnescapeFilename(t *testing.T) {
+	tests := []struct {
+		escaped string
+		filename string
+		ok bool
+	}{
+		{`plain`, "plain", true},
+		{`back\\slash`, `back\slash`, true},
+		{`line\nbreak`, "line\nbreak", true},
+		{`carriage\rreturn`, "carriage\rreturn", true},
+		{`\\n`, `\n`, true},
+		{`trailing\`, "", false},
+		{`unknown\t`, "", false},
+	}
+
+	for _, test := range tests {
+		filename, ok := unescapeFilename(test.escaped)
+		if ok != test.ok || filename != test.filename {
+			t.Errorf("unescapeFilename(%q) = %q, %v, want %q, %v", test.escaped, filename, ok, test.filename, test.ok)
+		}
+	}
+}
+
+// Every entry comes back the same after it is written and read again, in both
+// formats.
+func TestEntryRoundTrip(t *testing.T) {
+	filenames := []string{"file", "with space", `back\slash`, "line\nbreak", "carriage\rreturn", `\n`, "a (b) = c", "*star"}
+
+	for _, filename := range filenames {
+		for _, binary := range []bool{false, true} {
+			entry := &Entry{Checksum: sha1Sum, Filename: filename, Binary: binary}
+			assertRoundTrip(t, entry.String(), entry)
+		}
+		entry := &Entry{Checksum: sha1Sum, Filename: filename, Hash: crypto.SHA1}
+		assertRoundTrip(t, entry.TaggedString(), entry)
+	}
+}
+
+func assertRoundTrip(t *testing.T, line string, want *Entry) {
+	t.Helper()
+	r := NewReader(strings.NewReader(line + "\n"))
+	r.Hash = crypto.SHA1
+	entry, err := r.ReadEntry()
+	if err != nil {
+		t.Errorf("%q: %s", line, err)
+	} else if *entry != *want {
+		t.Errorf("%q reads as %+v, want %+v", line, entry, want)
+	}
+	if _, err := r.ReadEntry(); err != io.EOF {
+		t.Errorf("%q is read as more than one line", line)
+	}
+}
+
+func TestReadEntryMalformed(t *testing.T) {
+	tests := []struct {
+		line string
+		hash crypto.Hash
+	}{
+		{"", crypto.SHA1},
+		{sha1Sum[1:] + "  file", crypto.SHA1},
+		{sha1Sum + "0  file", crypto.SHA1},
+		{"xyz  file", 0x0},
+		{"MD5 (file) = " + sha1Sum, crypto.SHA1},
+		{`\` + sha1Sum + `  bad\escape`, crypto.SHA1},
+		{"garbage", crypto.SHA1},
+	}
+
+	for _, test := range tests {
+		r := NewReader(strings.NewReader(test.line + "\n"))
+		r.Hash = test.hash
+		entry, err := r.ReadEntry()
+		if perr, ok := err.(*ParseError); !ok {
+			t.Errorf("%q reads as %+v, %v, want a *ParseError", test.line, entry, err)
+		} else if perr.Line != 1 {
+			t.Errorf("%q is reported on line %d", test.line, perr.Line)
+		}
+	}
+}
+
+// A checksum file whose hash function is inferred checks every line against it.
+func TestManifestReadInfersHash(t *testing.T) {
+	lines := sha1Sum + "  a\n" + sha1Sum[1:] + "  b\n" + "MD5 (c) = d41d8cd98f00b204e9800998ecf8427e\n"
+
+	m := &Manifest{}
+	if err := m.Read(strings.NewReader(lines), ReadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Hash.Hash != crypto.SHA1 {
+		t.Errorf("inferred %s, want SHA1", &m.Hash)
+	}
+	if len(m.Entries) != 2 || len(m.Malformed) != 1 || m.Malformed[0].Line != 2 {
+		t.Errorf("read %d entries and %v, want 2 entries and line 2", len(m.Entries), m.Malformed)
+	}
+
+	m = &Manifest{}
+	err := m.Read(strings.NewReader(lines), ReadOptions{Strict: true})
+	if perr, ok := err.(*ParseError); !ok || perr.Line != 2 {
+		t.Errorf("strict read fails with %v, want line 2", err)
+	}
+}
+
+func TestManifestAddInOrder(t *testing.T) {
+	m := &Manifest{}
+	for _, filename := range []string{"b", "d", "a", "c", "e", "c"} {
+		m.Add(&Entry{Checksum: sha1Sum, Filename: filename})
+	}
+
+	var filenames []string
+	for _, entry := range m.Entries {
+		filenames = append(filenames, entry.Filename)
+	}
+	if got := strings.Join(filenames, " "); got != "a b c d e" {
+		t.Errorf("added in the order %s, want a b c d e", got)
+	}
+}
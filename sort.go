@@ -0,0 +1,58 @@
+package hv
+
+import (
+	"os"
+	"fmt"
+	"sort"
+)
+
+// The order in which entries are written to a generated checksum file: by name,
+// by size, or by modification time. Files of the same size or modification time
+// are in name order. The zero value sorts by name.
+type SortOrder struct {
+	Name string
+}
+
+func (o *SortOrder) String() string {
+	return o.Name
+}
+
+func (o *SortOrder) Set(s string) (err error) {
+	switch s {
+	case "name", "size", "mtime":
+		o.Name = s
+	default:
+		err = fmt.Errorf("%s is not a known sort order", s)
+	}
+	return
+}
+
+func (o *SortOrder) Values() []string {
+	return []string{"name", "size", "mtime"}
+}
+
+// Sort entries, whose filenames are relative to root, in place. Unless sorting
+// by name, every file is stat()ed, and the first error doing so is returned.
+func (o *SortOrder) Sort(root string, entries Entries) error {
+	sort.Sort(byFilename(entries))
+	if o.Name == "" || o.Name == "name" {
+		return nil
+	}
+
+	keys := make(map[*Entry]int64, len(entries))
+	for _, entry := range entries {
+		info, err := os.Stat(entry.Path(root))
+		if err != nil {
+			return err
+		}
+		if o.Name == "size" {
+			keys[entry] = info.Size()
+		} else {
+			keys[entry] = info.ModTime().UnixNano()
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return keys[entries[i]] < keys[entries[j]]
+	})
+	return nil
+}
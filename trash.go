@@ -0,0 +1,152 @@
+package hv
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"errors"
+	"syscall"
+	"math/rand"
+	"path/filepath"
+)
+
+// A quarantine directory that duplicates are moved into instead of being
+// deleted. Every file keeps its path relative to the directory that it was
+// found in, so that it is easy to tell where it came from.
+type Trash struct {
+	Dir string
+}
+
+// Link the file at path into t under filename, its slash-separated path
+// relative to the directory it was found in, and return where it ended up. The
+// file itself stays where it is. If the place in t is taken, e.g. by an earlier
+// run, a number is appended to the name. A hard link is made if t is on the
+// same filesystem as the file, and a copy otherwise.
+func (t *Trash) Link(path, filename string) (trashed string, err error) {
+	dest := FilePath(t.Dir, filename)
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return
+	}
+
+	trashed = dest
+	for n := 1; ; n++ {
+		err = os.Link(path, trashed)
+		if crossesDevices(err) {
+			err = copyFile(path, trashed)
+		}
+		if !os.IsExist(err) {
+			break
+		}
+		trashed = fmt.Sprintf("%s.%d", dest, n)
+	}
+	if err != nil {
+		return "", err
+	}
+	return
+}
+
+// Move the file at path into t the way Link does. The file only disappears from
+// path once it is in t, or once its copy there is on disk and found to hold the
+// same bytes.
+func (t *Trash) Move(path, filename string) (trashed string, err error) {
+	if trashed, err = t.Link(path, filename); err != nil {
+		return
+	}
+	if err = os.Remove(path); err != nil {
+		os.Remove(trashed)
+		return "", err
+	}
+	return
+}
+
+// Whether err is due to a link or rename between two filesystems.
+func crossesDevices(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// Copy the file at path to dest, which must not exist yet, for where a hard
+// link cannot be made. The copy keeps the file's mode and modification time,
+// and is synced and read back to make sure it holds the same bytes before this
+// returns; otherwise, it is removed again. A symbolic link is copied as a link.
+func copyFile(path, dest string) (err error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+	if info.Mode() & os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dest)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(dest)
+		}
+	}()
+
+	if _, err = io.Copy(dst, src); err != nil {
+		return
+	}
+	if err = dst.Sync(); err != nil {
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+	if err = os.Chtimes(dest, info.ModTime(), info.ModTime()); err != nil {
+		return
+	}
+
+	copied, err := os.Lstat(dest)
+	if err != nil {
+		return
+	}
+	a, b := &LazyFile{FileInfo: info, Path: path}, &LazyFile{FileInfo: copied, Path: dest}
+	defer a.Close()
+	defer b.Close()
+	equal, err := a.Equal(b)
+	if err == nil && !equal {
+		err = fmt.Errorf("%s: the copy of %s does not hold the same bytes", dest, path)
+	}
+	return
+}
+
+// Rename the file at path to dest, replacing whatever is there. Between two
+// filesystems, the file is copied to a temporary name next to dest, which is
+// renamed over dest, and only then removed from path.
+func moveFile(path, dest string) error {
+	err := os.Rename(path, dest)
+	if !crossesDevices(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(dest)
+	for tries := 0; ; tries++ {
+		temp := filepath.Join(dir, fmt.Sprintf(".%s.%d.hvcopy", base, rand.Int31()))
+		err := copyFile(path, temp)
+		if os.IsExist(err) && tries < 10 {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := os.Rename(temp, dest); err != nil {
+			os.Remove(temp)
+			return err
+		}
+		return os.Remove(path)
+	}
+}
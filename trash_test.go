@@ -0,0 +1,56 @@
+package hv
+
+import (
+	"os"
+	"time"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, dest := filepath.Join(dir, "file"), filepath.Join(dir, "copy")
+	writeFiles(t, dir, map[string][]byte{"file": []byte("contents\n"), "taken": []byte("other\n")})
+	modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFile(path, dest); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(dest); err != nil || string(data) != "contents\n" {
+		t.Errorf("the copy holds %q, %v", data, err)
+	}
+	if info, err := os.Stat(dest); err != nil {
+		t.Error(err)
+	} else if !info.ModTime().Equal(modTime) {
+		t.Errorf("the copy was modified at %s, want %s", info.ModTime(), modTime)
+	}
+
+	// A file in the way is neither overwritten nor removed.
+	taken := filepath.Join(dir, "taken")
+	if err := copyFile(path, taken); !os.IsExist(err) {
+		t.Errorf("copying over a file fails with %v, want it to exist", err)
+	}
+	if data, err := ioutil.ReadFile(taken); err != nil || string(data) != "other\n" {
+		t.Errorf("the file in the way holds %q, %v", data, err)
+	}
+
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("file", link); err != nil {
+		t.Skip(err)
+	}
+	if err := copyFile(link, filepath.Join(dir, "link copy")); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "link copy")); err != nil || target != "file" {
+		t.Errorf("the copy of a link leads to %q, %v", target, err)
+	}
+}
@@ -0,0 +1,115 @@
+package hv
+
+import (
+	"os"
+	"sort"
+)
+
+// Options that control how a checksum file is updated.
+type UpdateOptions struct {
+	// Where to look for new files.
+	WalkOptions
+	// The number of files to hash concurrently.
+	Jobs int
+	// Where to count the files and bytes hashed so far, if anywhere. Only files
+	// that are hashed again count.
+	Progress *Progress
+}
+
+// The filenames that Update has added, updated or removed.
+type Changes struct {
+	Added []string
+	Updated []string
+	Removed []string
+}
+
+// Bring m up to date with the files in m.Root. Files that are not in m yet are
+// added, files that no longer exist are removed, and files whose stamp differs
+// from the one in cache are hashed again. All other checksums are carried over
+// without reading the files. Returns the stamps of every file now in m, which
+// is to be the cache for the next update. If any file cannot be hashed, the
+// error for the first one is returned and m is left alone.
+func (m *Manifest) Update(cache map[string]Stamp, opts UpdateOptions) (changes Changes, stamps map[string]Stamp, err error) {
+	found, err := EntriesFromPath(m.Root, m.ignoringSelf(opts.WalkOptions))
+	if err != nil {
+		return
+	}
+
+	old := make(map[string]*Entry)
+	for _, entry := range m.Entries {
+		old[entry.Filename] = entry
+	}
+
+	// Files that are on disk are candidates, and so are files in the checksum
+	// file that were not found, e.g. because they live in a subdirectory and
+	// opts.Recursive is not set. Only the latter that no longer exist are
+	// removed.
+	candidates := make(Entries, 0, len(found))
+	seen := make(map[string]bool)
+	for _, entry := range found {
+		candidates = append(candidates, entry)
+		seen[entry.Filename] = true
+	}
+	for _, entry := range m.Entries {
+		if !seen[entry.Filename] {
+			candidates = append(candidates, &Entry{Filename: entry.Filename})
+		}
+	}
+
+	stamps = make(map[string]Stamp)
+	var stale Entries
+	for _, entry := range candidates {
+		info, err := os.Stat(entry.Path(m.Root))
+		if os.IsNotExist(err) {
+			changes.Removed = append(changes.Removed, entry.Filename)
+			continue
+		} else if err != nil {
+			return changes, nil, err
+		}
+
+		// Entries keep their own hash function and binary marker, whether they
+		// are carried over or hashed again.
+		stamp := StampOf(info)
+		stamps[entry.Filename] = stamp
+		tracked, exists := old[entry.Filename]
+		if exists {
+			entry.Hash, entry.Binary = tracked.Hash, tracked.Binary
+		}
+		if cached, stamped := cache[entry.Filename]; exists && stamped && cached == stamp {
+			entry.Checksum = tracked.Checksum
+		} else {
+			stale = append(stale, entry)
+		}
+	}
+
+	opts.Progress.measure(m.Root, stale)
+	errs := make([]error, len(stale))
+	stale.Parallel(opts.Jobs, func(i int, entry *Entry) {
+		defer opts.Progress.doneFile()
+		errs[i] = entry.fill(m.Root, entry.HashOr(m.Hash.Hash), opts.Progress)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return Changes{}, nil, err
+		}
+	}
+
+	for _, entry := range stale {
+		if tracked, exists := old[entry.Filename]; !exists {
+			changes.Added = append(changes.Added, entry.Filename)
+		} else if tracked.Checksum != entry.Checksum {
+			changes.Updated = append(changes.Updated, entry.Filename)
+		}
+	}
+	sort.Strings(changes.Removed)
+
+	entries := make(Entries, 0, len(stamps))
+	for _, entry := range candidates {
+		if _, exists := stamps[entry.Filename]; exists {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Sort(byFilename(entries))
+	m.Entries = entries
+	return
+}
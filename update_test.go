@@ -0,0 +1,48 @@
+package hv
+
+import (
+	"os"
+	"crypto"
+	"reflect"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// A file that appears next to a checksum file in which every checksum is
+// tagged is hashed with the hash function of the tagged ones.
+func TestUpdateTaggedOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "tagged.sums")
+	writeFiles(t, dir, map[string][]byte{
+		"empty": nil,
+		"new": nil,
+		"tagged.sums": []byte("SHA1 (empty) = " + sha1Sum + "\n"),
+	})
+
+	m, err := OpenManifestFile(filename, dir, HashValue{}, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Hash.Hash != crypto.SHA1 {
+		t.Errorf("inferred %s, want SHA1", &m.Hash)
+	}
+
+	changes, _, err := m.Update(nil, UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes.Added, []string{"new"}) {
+		t.Errorf("added %v, want [new]", changes.Added)
+	}
+	for _, entry := range m.Entries {
+		if entry.Checksum != sha1Sum {
+			t.Errorf("%s has checksum %s, want %s", entry.Filename, entry.Checksum, sha1Sum)
+		}
+	}
+}
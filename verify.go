@@ -1,82 +1,126 @@
-package main
+package hv
 
 import (
-	"fmt"
-	"strings"
 	"os"
+	"crypto"
 )
 
-var (
-	// Declared in common:
-	// hashFunction HashValue
-	// cwd string
-	// silent bool
+// The outcome of verifying a single file.
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusMismatch
+	StatusMissing
+	StatusUntracked
+	StatusError
 )
 
-var cmdVerify = &Command{
-	Run: runVerify,
-	Usage: `verify [-s] [-c=hash] [-D=dir] [file]`,
-	Short: "Verify using a checksum file",
-	Long: `
-Verify all files for the given directory against a checksum file. If a specific
-file is given, only that file is verified.
+func (s Status) String() string {
+	switch s {
+	case StatusOK: return "OK"
+	case StatusMismatch: return "MISMATCH"
+	case StatusMissing: return "MISSING"
+	case StatusUntracked: return "UNTRACKED"
+	case StatusError: return "ERROR"
+	default: return ""
+	}
+}
 
-If verification is successful, then the exit status will be 0 and no output will
-be written. If there is a checksum mismatch, then the exit status will be 1 and
-the mismatch(es) in question will be written to STDERR unless silent mode is on.`,
+// Whether s takes precedence over other when several outcomes are summarized.
+func (s Status) MoreSevere(other Status) bool {
+	rank := func(s Status) int {
+		switch s {
+		case StatusOK: return 0
+		case StatusUntracked: return 1
+		case StatusMissing: return 2
+		case StatusError: return 3
+		default: return 4
+		}
+	}
+	return rank(s) > rank(other)
 }
 
-// Initialized in common:
-// var preferredHashes []string
+// The outcome of verifying the file of Entry.
+type Result struct {
+	Entry *Entry
+	Status Status
+	// The checksum that the file actually has, if it could be read.
+	Actual string
+	// The error that the file could not be read with, if the status is
+	// StatusError.
+	Err error
+}
 
-func init() {
-	const (
-		silentUsage = "silent; don't output to STDERR"
-		cwdUsage = "the directory to verify using its checksum file"
-	)
-	hashUsage := fmt.Sprintf("the hash to use; if unspecified, the following are tried in order: %s", strings.Join(preferredHashes, ", "))
-	f := &cmdVerify.Flag
-	f.BoolVar(&silent, "s", false, silentUsage)
-	f.Var(&hashFunction, "c", hashUsage)
-	f.StringVar(&cwd, "D", ".", cwdUsage)
+// Options that control how a checksum file is verified.
+type VerifyOptions struct {
+	// Where to look for untracked files.
+	WalkOptions
+	// Whether to look for untracked files at all.
+	Untracked bool
+	// The number of files to hash concurrently.
+	Jobs int
+	// Where to count the files and bytes hashed so far, if anywhere.
+	Progress *Progress
 }
 
-func runVerify(cmd *Command, args []string) {
-	var err error
-	hash, checksums := setDirAndHashOptions()
-	singleFileMode, singleFile := false, ""
-	if len(args) == 1 {
-		singleFileMode = true
-		singleFile = args[0]
-	}
+// Verify every entry of m. The results are in the same order as m.Entries,
+// followed by a result for every untracked file if opts.Untracked is set.
+func (m *Manifest) Verify(opts VerifyOptions) (results []Result, err error) {
+	results = make([]Result, len(m.Entries))
+	opts.Progress.measure(m.Root, m.Entries)
+	m.Entries.Parallel(opts.Jobs, func(i int, entry *Entry) {
+		defer opts.Progress.doneFile()
+		results[i] = m.verifyEntry(entry, opts.Progress)
+	})
 
-	allMatch := true
-	r := NewReader(checksums)
-	err = r.Each(func(entry *Entry) {
-		if singleFileMode && entry.Filename != singleFile {
-			return // continue
-		}
+	if !opts.Untracked {
+		return
+	}
 
-		if ok, err := entry.Verify(hash.Hash); err != nil {
-			if !silent {
-				croak(err)
-			}
-			allMatch = false
-		} else if !ok {
-			if !silent {
-				warn("%s does not match %s\n", entry.Filename, entry.Checksum)
-			}
-			allMatch = false
-		}
-	})
+	untracked, err := m.Untracked(opts.WalkOptions)
 	if err != nil {
-		die(err)
+		return
+	}
+	for _, entry := range untracked {
+		results = append(results, Result{Entry: entry, Status: StatusUntracked})
+	}
+	return
+}
+
+func (m *Manifest) verifyEntry(entry *Entry, progress *Progress) Result {
+	h := entry.HashOr(m.Hash.Hash)
+	sums, err := entry.calculateAll(m.Root, []crypto.Hash{h}, progress)
+	switch {
+	case os.IsNotExist(err):
+		return Result{Entry: entry, Status: StatusMissing}
+	case err != nil:
+		return Result{Entry: entry, Status: StatusError, Err: err}
 	}
 
-	if allMatch {
-		os.Exit(0)
-	} else {
-		os.Exit(1)
+	actual := formatChecksum(h, sums[0])
+	if actual != entry.Checksum {
+		return Result{Entry: entry, Status: StatusMismatch, Actual: actual}
 	}
+	return Result{Entry: entry, Status: StatusOK, Actual: actual}
 }
 
+// Find the files in m.Root that are not listed in m. The checksum file itself
+// is never untracked.
+func (m *Manifest) Untracked(opts WalkOptions) (untracked Entries, err error) {
+	known := make(map[string]bool)
+	for _, entry := range m.Entries {
+		known[entry.Filename] = true
+	}
+
+	entries, err := EntriesFromPath(m.Root, m.ignoringSelf(opts))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !known[entry.Filename] {
+			untracked = append(untracked, entry)
+		}
+	}
+	return
+}
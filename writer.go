@@ -1,39 +1,49 @@
-package main
+package hv
 
 import (
 	"io"
 	"fmt"
-	"os"
+	"sort"
 )
 
 type Writer struct {
 	io.Writer
+	// Whether to write entries in the BSD or tagged format instead.
+	Tagged bool
 }
 
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{w}
+	return &Writer{Writer: w}
 }
 
 func (w *Writer) WriteEntry(entry *Entry) (written int, err error) {
+	if w.Tagged {
+		return fmt.Fprintf(w, "%s\n", entry.TaggedString())
+	}
 	return fmt.Fprintf(w, "%s\n", entry.String())
 }
 
+// Write data, a map from filename to checksum as returned by Load, to filename
+// in filename order, replacing the file atomically.
 func Dump(filename string, data map[string]string) (written int, err error) {
-	file, err := os.Create(filename)
-	if err != nil {
-		return
+	filenames := make([]string, 0, len(data))
+	for name := range data {
+		filenames = append(filenames, name)
 	}
+	sort.Strings(filenames)
 
-	w := &Writer{file}
-	for filename, checksum := range data {
-		entry := &Entry{Filename: filename, Checksum: checksum}
-		if n, err := w.WriteEntry(entry); err == nil {
+	err = writeFileAtomically(filename, func(file io.Writer) error {
+		w := NewWriter(file)
+		for _, name := range filenames {
+			entry := &Entry{Filename: name, Checksum: data[name]}
+			n, err := w.WriteEntry(entry)
 			written += n
-		} else {
-			return written, err
+			if err != nil {
+				return err
+			}
 		}
-	}
-
+		return nil
+	})
 	return
 }
 